@@ -0,0 +1,70 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+)
+
+// runCommand 分发子命令，返回进程退出码
+func runCommand(name string, args []string) int {
+	switch name {
+	case "quarantine":
+		return runQuarantine(args)
+	case "rules":
+		return runRules(args)
+	case "events":
+		return runEvents(args)
+	case "devices":
+		return runDevices(args)
+	case "tail":
+		return runTail(args)
+	case "help", "-h", "-help", "--help":
+		usage()
+		return 0
+	default:
+		fmt.Fprintf(os.Stderr, "unknown command %q\n\n", name)
+		usage()
+		return 2
+	}
+}
+
+func usage() {
+	fmt.Fprint(os.Stderr, `Usage:
+  usbSentry [flags]                  start the agent (requires root), see usbSentry -h
+  usbSentry -print-config [flags]    print the effective configuration
+  usbSentry quarantine list          list quarantined files
+  usbSentry quarantine restore <id>  restore a file to its original path
+  usbSentry quarantine purge <id>... delete quarantined files
+  usbSentry rules add [-vid 0781] [-pid 5583] [-serial SN|glob] [-product glob]
+                     [-type deny|allow|readonly] [-priority N] [-reason text] [-expires 72h]
+  usbSentry rules exempt -vid 0781 -pid 5583 -serial SN [-hours 4] [-granted-by name] [-reason text]
+  usbSentry rules remove -id N | [-vid ..] [-pid ..] [-serial ..] [-product ..]
+  usbSentry rules list [-format table|csv|json]
+  usbSentry rules import [-format csv|json] [-replace] <file|->
+  usbSentry rules export [-format csv|json] [file]
+  usbSentry rules mode [default-allow|default-deny]
+  usbSentry devices list [-serial SN|glob] [-vid ..] [-pid ..] [-product glob] [-since 720h] [-format table|csv|json]
+  usbSentry devices export [-format csv|json] [file]
+  usbSentry events query [-since 24h] [-until time] [-type usb|file|analysis|session] [-serial SN] [-session ID]
+                     [-process name] [-path glob] [-op CLOSE_WRITE] [-limit N] [-format table|json|jsonl]
+  usbSentry tail [-type usb|file|analysis|session] [-device SN|/dev/sdb1|vid:pid] [-session ID]
+                     [-process name] [-path glob] [-op CLOSE_WRITE] [-format pretty|json]
+`)
+}
+
+// parseArgs 解析参数，允许 flag 出现在位置参数之后 (标准库遇到第一个位置参数就停止)
+// 返回全部位置参数
+func parseArgs(fs *flag.FlagSet, args []string) ([]string, error) {
+	var positional []string
+	for {
+		if err := fs.Parse(args); err != nil {
+			return nil, err
+		}
+		if fs.NArg() == 0 {
+			return positional, nil
+		}
+		positional = append(positional, fs.Arg(0))
+		args = fs.Args()[1:]
+	}
+}
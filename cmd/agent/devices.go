@@ -0,0 +1,126 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"text/tabwriter"
+	"time"
+
+	"github.com/Hara602/usbSentry/internal/blackwhitelist"
+)
+
+// CSV 导出的列顺序
+var inventoryCSVHeader = []string{"vid", "pid", "serial", "product", "manufacturer", "first_seen", "last_seen", "insert_count", "last_verdict", "last_reason"}
+
+// runDevices usbSentry devices list|export
+func runDevices(args []string) int {
+	if len(args) == 0 {
+		usage()
+		return 2
+	}
+
+	fs := flag.NewFlagSet("devices "+args[0], flag.ContinueOnError)
+	dbPath := fs.String("db", loadCommandConfig().DBPath, "blackwhitelist database")
+	vid := fs.String("vid", "", "vendor id")
+	pid := fs.String("pid", "", "product id")
+	serial := fs.String("serial", "", "serial number or glob")
+	product := fs.String("product", "", "product string glob, case-insensitive")
+	since := fs.String("since", "", "only devices seen since: RFC 3339 / 2006-01-02 15:04:05, or a duration ago, e.g. 720h")
+	format := fs.String("format", "", "output format: table, csv or json")
+	positional, err := parseArgs(fs, args[1:])
+	if err != nil {
+		return 2
+	}
+
+	filter := blackwhitelist.InventoryFilter{Vid: *vid, Pid: *pid, Serial: *serial, Product: *product}
+	if filter.Since, err = parseTimeArg(*since); err != nil {
+		fmt.Fprintln(os.Stderr, "-since:", err)
+		return 2
+	}
+
+	if err := blackwhitelist.InitBlackWhiteDB(*dbPath); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	var out io.Writer = os.Stdout
+	f := *format
+	switch args[0] {
+	case "list":
+		if f == "" {
+			f = "table"
+		}
+	case "export":
+		if len(positional) > 0 && positional[0] != "-" {
+			file, err := os.Create(positional[0])
+			if err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				return 1
+			}
+			defer file.Close()
+			out = file
+		}
+		if f == "" {
+			f = formatFromPath(positional, "json")
+		}
+	default:
+		fmt.Fprintf(os.Stderr, "unknown devices command %q\n", args[0])
+		return 2
+	}
+
+	items, err := blackwhitelist.ListInventory(filter)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	// 查某个序列号是否出现过时，没有结果用退出码 1 表示
+	if args[0] == "list" && len(items) == 0 {
+		fmt.Fprintln(os.Stderr, "no matching devices")
+		return 1
+	}
+	if err := writeInventory(out, f, items); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	return 0
+}
+
+func writeInventory(w io.Writer, format string, items []blackwhitelist.InventoryItem) error {
+	switch format {
+	case "table":
+		tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(tw, "VID\tPID\tSERIAL\tPRODUCT\tMANUFACTURER\tFIRST SEEN\tLAST SEEN\tINSERTS\tLAST VERDICT")
+		for _, it := range items {
+			fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\t%s\t%d\t%s\n",
+				it.Vid, it.Pid, it.Serial, it.Product, it.Manufacturer,
+				it.FirstSeen.Local().Format(time.DateTime), it.LastSeen.Local().Format(time.DateTime),
+				it.InsertCount, it.LastVerdict)
+		}
+		return tw.Flush()
+
+	case "json":
+		if items == nil {
+			items = []blackwhitelist.InventoryItem{}
+		}
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(items)
+
+	case "csv":
+		cw := csv.NewWriter(w)
+		cw.Write(inventoryCSVHeader)
+		for _, it := range items {
+			cw.Write([]string{it.Vid, it.Pid, it.Serial, it.Product, it.Manufacturer,
+				it.FirstSeen.UTC().Format(time.RFC3339), it.LastSeen.UTC().Format(time.RFC3339),
+				strconv.Itoa(it.InsertCount), it.LastVerdict, it.LastReason})
+		}
+		cw.Flush()
+		return cw.Error()
+	}
+	return fmt.Errorf("unknown format %q", format)
+}
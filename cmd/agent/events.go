@@ -0,0 +1,186 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/Hara602/usbSentry/internal/eventstore"
+	"github.com/Hara602/usbSentry/internal/model"
+)
+
+// runEvents usbSentry events query
+func runEvents(args []string) int {
+	if len(args) == 0 || args[0] != "query" {
+		usage()
+		return 2
+	}
+
+	fs := flag.NewFlagSet("events query", flag.ContinueOnError)
+	dbPath := fs.String("db", loadCommandConfig().Events.DBPath, "event database")
+	since := fs.String("since", "", "start time: RFC 3339 / 2006-01-02 15:04:05, or a duration ago, e.g. 24h")
+	until := fs.String("until", "", "end time, same format as -since")
+	typ := fs.String("type", "", "event type: usb, file, analysis or session")
+	serial := fs.String("serial", "", "device serial number")
+	session := fs.String("session", "", "insertion session id")
+	process := fs.String("process", "", "process name")
+	pathGlob := fs.String("path", "", "path glob, * also matches /, e.g. '/media/*.exe'")
+	op := fs.String("op", "", "operation, e.g. CLOSE_WRITE, OPEN_PERM, add, remove")
+	limit := fs.Int("limit", 100, "show at most the newest N events (0 = all)")
+	format := fs.String("format", "table", "output format: table, json or jsonl")
+	if _, err := parseArgs(fs, args[1:]); err != nil {
+		return 2
+	}
+
+	filter := eventstore.Filter{Type: *typ, Serial: *serial, Session: *session, Process: *process, Path: *pathGlob, Op: *op, Limit: *limit}
+	var err error
+	if filter.Since, err = parseTimeArg(*since); err != nil {
+		fmt.Fprintln(os.Stderr, "-since:", err)
+		return 2
+	}
+	if filter.Until, err = parseTimeArg(*until); err != nil {
+		fmt.Fprintln(os.Stderr, "-until:", err)
+		return 2
+	}
+
+	// 只读查询，库不存在时不要顺手创建一个空库
+	if _, err := os.Stat(*dbPath); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	store, err := eventstore.Open(*dbPath)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	defer store.Close()
+
+	events, err := store.Query(filter)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	if err := writeEvents(os.Stdout, *format, events); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	return 0
+}
+
+// parseTimeArg 解析绝对时间 (RFC 3339 或本地时间) 或相对时长 (多久以前)
+func parseTimeArg(s string) (time.Time, error) {
+	if s == "" {
+		return time.Time{}, nil
+	}
+	if d, err := time.ParseDuration(s); err == nil {
+		return time.Now().Add(-d), nil
+	}
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t, nil
+	}
+	for _, layout := range []string{time.DateTime, "2006-01-02 15:04", time.DateOnly} {
+		if t, err := time.ParseInLocation(layout, s, time.Local); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("invalid time %q", s)
+}
+
+func writeEvents(w io.Writer, format string, events []model.Event) error {
+	switch format {
+	case "table":
+		tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(tw, "TIME\tTYPE\tOP\tVERDICT\tPROCESS\tDEVICE\tPATH\tDETAIL")
+		for _, ev := range events {
+			fmt.Fprintln(tw, strings.Join(eventRow(ev), "\t"))
+		}
+		return tw.Flush()
+
+	case "json":
+		if events == nil {
+			events = []model.Event{}
+		}
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(events)
+
+	case "jsonl":
+		enc := json.NewEncoder(w)
+		for _, ev := range events {
+			if err := enc.Encode(ev); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	return fmt.Errorf("unknown format %q", format)
+}
+
+// eventRow 表格中的一行，与 writeEvents 的表头对应
+func eventRow(ev model.Event) []string {
+	ts := ev.Time.Local().Format(time.DateTime)
+	dev := ""
+	if d := ev.Device(); d != nil {
+		dev = deviceLabel(d.Device)
+	}
+	switch {
+	case ev.USB != nil:
+		e := ev.USB
+		return []string{ts, ev.Type, e.Action, "", "", dev, e.MountPoint,
+			strings.TrimSpace(e.DeviceType + " " + e.DevicePath)}
+	case ev.File != nil:
+		e := ev.File
+		path := e.FilePath
+		if e.OldPath != "" {
+			path = e.OldPath + " -> " + e.FilePath
+		}
+		return []string{ts, ev.Type, e.Operation, e.Verdict, processLabel(e), dev, path, e.Reason}
+	case ev.Analysis != nil:
+		e := ev.Analysis
+		proc := ""
+		if e.ProcName != "" {
+			proc = fmt.Sprintf("%s(%d)", e.ProcName, e.PID)
+		}
+		detail := e.Message
+		if e.QuarantineID != "" {
+			detail += " [quarantined " + e.QuarantineID + "]"
+		}
+		return []string{ts, ev.Type, e.Analyzer, e.RiskLevel, proc, dev, e.FilePath, detail}
+	case ev.Session != nil:
+		e := ev.Session
+		procs := make([]string, 0, len(e.Processes))
+		for _, p := range e.Processes {
+			procs = append(procs, p.Name)
+		}
+		detail := fmt.Sprintf("%s, created=%d written=%d deleted=%d renamed=%d size=%d denied=%d",
+			(time.Duration(e.DurationSeconds) * time.Second).String(),
+			e.FilesCreated, e.FilesWritten, e.FilesDeleted, e.FilesRenamed, e.WrittenFilesSize, e.Denied)
+		return []string{ts, ev.Type, e.EndReason, "", strings.Join(procs, ","), dev, e.Device.MountPoint, detail}
+	}
+	return []string{ts, ev.Type, "", "", "", "", "", ""}
+}
+
+// processLabel 进程名(pid,用户)，sudo 等切换过用户时附上登录用户
+func processLabel(e *model.FileEvent) string {
+	p := e.Process
+	if p == nil || p.EUser == "" {
+		return fmt.Sprintf("%s(%d)", e.ProcName, e.PID)
+	}
+	user := p.EUser
+	if p.LoginUser != "" && p.LoginUser != p.EUser {
+		user += " via " + p.LoginUser
+	}
+	return fmt.Sprintf("%s(%d,%s)", e.ProcName, e.PID, user)
+}
+
+func deviceLabel(d model.Device) string {
+	if d.Vid == "" && d.Pid == "" && d.Serial == "" {
+		return ""
+	}
+	return fmt.Sprintf("%s:%s/%s", d.Vid, d.Pid, d.Serial)
+}
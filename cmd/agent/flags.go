@@ -0,0 +1,91 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/Hara602/usbSentry/internal/config"
+)
+
+// agentOptions 命令行解析结果
+type agentOptions struct {
+	cfg         *config.Config
+	printConfig bool
+}
+
+// parseAgentFlags 读取配置文件，再用命令行参数覆盖 (只覆盖显式给出的参数)
+func parseAgentFlags(args []string, stderr io.Writer) (*agentOptions, error) {
+	fs := flag.NewFlagSet("usbSentry", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+
+	def := config.Default()
+	configPath := fs.String("config", config.DefaultPath, "config file (YAML)")
+	printConfig := fs.Bool("print-config", false, "print the effective configuration and exit")
+	dbPath := fs.String("db", def.DBPath, "blackwhitelist database")
+	policyPath := fs.String("policy", def.PolicyPath, "file access policy (JSON)")
+	logLevel := fs.String("log-level", def.Log.Level, "log level: debug, info, warn, error")
+	logFormat := fs.String("log-format", def.Log.Format, "log format: console, json")
+	logOutput := fs.String("log-output", def.Log.Output, "log destination: stdout, stderr or a file path")
+	mode := fs.String("mode", def.Enforce.Mode, "enforcement mode: enforce, audit")
+	deviceMode := fs.String("device-mode", def.Enforce.DeviceMode, "device list mode: default-allow, default-deny (empty = keep database setting)")
+	blockEmpty := fs.Bool("block-empty-serial", def.Enforce.BlockEmptySerial, "block devices with an empty or all-zero serial")
+	analyzers := fs.String("analyzers", strings.Join(def.Analyzers, ","), "comma-separated analyzers to enable")
+	mountTimeout := fs.Duration("mount-timeout", def.Mount.WaitTimeout, "how long to wait for a partition to be mounted")
+	quarantineDir := fs.String("quarantine-dir", def.Quarantine.Dir, "quarantine vault directory")
+	apiSocket := fs.String("api-socket", def.API.Socket, "control API unix socket (empty = disabled)")
+	metricsListen := fs.String("metrics-listen", def.Metrics.Listen, "Prometheus metrics address on loopback, e.g. 127.0.0.1:9477 (empty = disabled)")
+	eventsDB := fs.String("events-db", def.Events.DBPath, "local event database (empty = do not store events)")
+	if err := fs.Parse(args); err != nil {
+		return nil, err
+	}
+	if fs.NArg() > 0 {
+		return nil, fmt.Errorf("unexpected argument %q", fs.Arg(0))
+	}
+
+	// 只有显式指定 -config 时，配置文件不存在才报错
+	explicit := map[string]bool{}
+	fs.Visit(func(f *flag.Flag) { explicit[f.Name] = true })
+
+	cfg, err := config.Load(*configPath, explicit["config"])
+	if err != nil {
+		return nil, err
+	}
+
+	overrides := map[string]func(){
+		"db":                 func() { cfg.DBPath = *dbPath },
+		"policy":             func() { cfg.PolicyPath = *policyPath },
+		"log-level":          func() { cfg.Log.Level = *logLevel },
+		"log-format":         func() { cfg.Log.Format = *logFormat },
+		"log-output":         func() { cfg.Log.Output = *logOutput },
+		"mode":               func() { cfg.Enforce.Mode = *mode },
+		"device-mode":        func() { cfg.Enforce.DeviceMode = *deviceMode },
+		"block-empty-serial": func() { cfg.Enforce.BlockEmptySerial = *blockEmpty },
+		"analyzers":          func() { cfg.Analyzers = config.ParseList(*analyzers) },
+		"mount-timeout":      func() { cfg.Mount.WaitTimeout = *mountTimeout },
+		"quarantine-dir":     func() { cfg.Quarantine.Dir = *quarantineDir },
+		"events-db":          func() { cfg.Events.DBPath = *eventsDB },
+		"api-socket":         func() { cfg.API.Socket = *apiSocket },
+		"metrics-listen":     func() { cfg.Metrics.Listen = *metricsListen },
+	}
+	for name, apply := range overrides {
+		if explicit[name] {
+			apply()
+		}
+	}
+
+	if err := cfg.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid configuration:\n%w", err)
+	}
+	return &agentOptions{cfg: cfg, printConfig: *printConfig}, nil
+}
+
+// loadCommandConfig 子命令使用的配置 (只读默认配置文件，用于取数据库/隔离区路径的默认值)
+func loadCommandConfig() *config.Config {
+	cfg, err := config.Load(config.DefaultPath, false)
+	if err != nil {
+		return config.Default()
+	}
+	return cfg
+}
@@ -1,25 +1,82 @@
 package main
 
 import (
+	"fmt"
 	"os"
 	"os/signal"
+	"strings"
 	"syscall"
+	"time"
 
+	"github.com/Hara602/usbSentry/internal/api"
 	"github.com/Hara602/usbSentry/internal/blackwhitelist"
+	"github.com/Hara602/usbSentry/internal/config"
+	"github.com/Hara602/usbSentry/internal/eventstore"
+	"github.com/Hara602/usbSentry/internal/metrics"
+	"github.com/Hara602/usbSentry/internal/model"
 	"github.com/Hara602/usbSentry/internal/monitor"
+	"github.com/Hara602/usbSentry/internal/policy"
+	"github.com/Hara602/usbSentry/internal/quarantine"
+	"github.com/Hara602/usbSentry/internal/registry"
+	"github.com/Hara602/usbSentry/internal/session"
+	"github.com/Hara602/usbSentry/internal/sink"
 	"github.com/Hara602/usbSentry/internal/sysutil"
 	"github.com/Hara602/usbSentry/internal/watcher"
 	"go.uber.org/zap"
 )
 
 func main() {
+	// 子命令 (管理工具)，不启动 Agent
+	if len(os.Args) > 1 && !strings.HasPrefix(os.Args[1], "-") {
+		os.Exit(runCommand(os.Args[1], os.Args[2:]))
+	}
+
+	// 配置文件 + 命令行参数
+	opts, err := parseAgentFlags(os.Args[1:], os.Stderr)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+	cfg := opts.cfg
+	if opts.printConfig {
+		fmt.Print(cfg.YAML())
+		return
+	}
+
 	// 初始化日志
-	sysutil.InitLogger()
+	if err := sysutil.InitLogger(sysutil.LogOptions{
+		Level:      cfg.Log.Level,
+		Format:     cfg.Log.Format,
+		Output:     cfg.Log.Output,
+		MaxSizeMB:  cfg.Log.MaxSizeMB,
+		MaxAgeDays: cfg.Log.MaxAgeDays,
+		MaxBackups: cfg.Log.MaxBackups,
+		Compress:   cfg.Log.Compress,
+	}); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
 	defer sysutil.Log.Sync()
 
 	// 初始化黑白名单数据库
-	if err := blackwhitelist.InitBlackWhiteDB("./internal/db/blacklist.db"); err != nil {
-		sysutil.Log.Fatal("blackwhitelist database init failed!")
+	if err := blackwhitelist.InitBlackWhiteDB(cfg.DBPath); err != nil {
+		sysutil.Log.Fatal("blackwhitelist database init failed!", zap.Error(err))
+	}
+	blackwhitelist.BlockEmptySerial = cfg.Enforce.BlockEmptySerial
+	if cfg.Enforce.DeviceMode != "" {
+		if err := blackwhitelist.SetMode(cfg.Enforce.DeviceMode); err != nil {
+			sysutil.Log.Fatal("set device mode failed", zap.Error(err))
+		}
+	}
+
+	// 定期清理过期的规则和临时豁免
+	stopExpirer := blackwhitelist.StartExpirer(time.Minute)
+	defer stopExpirer()
+
+	// 加载文件访问策略 (文件不存在时全部放行)
+	engine, err := policy.LoadFile(cfg.PolicyPath)
+	if err != nil {
+		sysutil.Log.Fatal("policy load failed", zap.Error(err))
 	}
 
 	// Fanotify 需要 Root 权限
@@ -27,15 +84,71 @@ func main() {
 		sysutil.LogSugar.Fatal("Must run as root (required by Netlink/Fanotify).")
 	}
 
-	sysutil.Log.Info("🛡️ USB Sentry Agent Starting...")
+	sysutil.Log.Info("🛡️ USB Sentry Agent Starting...",
+		zap.String("mode", cfg.Enforce.Mode),
+		zap.String("device_mode", blackwhitelist.GetMode()),
+		zap.Strings("analyzers", cfg.Analyzers),
+	)
 
 	// 初始化核心模块 (依赖注入)
-	devWatcher := watcher.New()
-	fileMon, err := monitor.New()
+	devices := registry.New()
+	devWatcher := watcher.New(watcher.Config{
+		Registry:     devices,
+		BadUSB:       cfg.Enabled(config.AnalyzerBadUSB),
+		Audit:        cfg.Audit(),
+		MountTimeout: cfg.Mount.WaitTimeout,
+		MountPoll:    cfg.Mount.PollInterval,
+	})
+	vault, err := quarantine.Open(cfg.Quarantine.Dir)
+	if err != nil {
+		sysutil.Log.Fatal("quarantine init failed", zap.Error(err))
+	}
+	fileMon, err := monitor.New(monitor.Config{
+		Policy:         engine,
+		Quarantine:     vault,
+		RemoveOriginal: cfg.Quarantine.RemoveOriginal && !cfg.Audit(), // 审计模式不动 U 盘上的文件
+		FileType:       cfg.Enabled(config.AnalyzerFileType),
+		Audit:          cfg.Audit(),
+	})
 	if err != nil {
 		sysutil.Log.Fatal("Monitor init failed", zap.Error(err))
 	}
 
+	// 事件输出 (JSONL / stdout / webhook / unixgram)
+	sinks, err := sink.NewFanout(cfg.Sinks)
+	if err != nil {
+		sysutil.Log.Fatal("sink init failed", zap.Error(err))
+	}
+	defer sinks.Close(5 * time.Second)
+	var storeWriter *eventstore.Writer
+	if cfg.Events.DBPath != "" {
+		store, err := eventstore.Open(cfg.Events.DBPath)
+		if err != nil {
+			sysutil.Log.Fatal("event store init failed", zap.Error(err))
+		}
+		// 事件库是审计记录，用专用的写入协程，不和其他 sink 一样在队列满时丢弃
+		storeWriter = eventstore.NewWriter(store)
+		defer storeWriter.Close()
+		sinks.AttachRecorder(storeWriter)
+	}
+
+	// 本地控制 API
+	recent := api.NewRecent(cfg.API.RecentEvents)
+	sinks.Attach(recent, config.SinkConfig{})
+	if cfg.API.Socket != "" {
+		server, err := api.Listen(api.Config{
+			Socket:   cfg.API.Socket,
+			Group:    cfg.API.Group,
+			Mode:     cfg.Enforce.Mode,
+			Registry: devices,
+			Recent:   recent,
+		})
+		if err != nil {
+			sysutil.Log.Fatal("control API init failed", zap.Error(err))
+		}
+		defer server.Close()
+	}
+
 	// 3. 启动
 	fileMon.Start()
 	defer fileMon.Stop()
@@ -46,6 +159,26 @@ func main() {
 	}
 	defer devWatcher.Stop()
 
+	// 会话统计，拔出时生成汇总
+	sessions := session.NewTracker()
+
+	// Prometheus 指标
+	if cfg.Metrics.Listen != "" {
+		metrics.DevicesConnected(devices.Len)
+		metrics.ChannelDepth("usb_events", func() int { return len(usbEvents) })
+		metrics.ChannelDepth("file_events", func() int { return len(fileMon.Events()) })
+		metrics.ChannelDepth("findings", func() int { return len(fileMon.Findings()) })
+		metrics.ChannelDepth("sinks", sinks.Pending)
+		if storeWriter != nil {
+			metrics.ChannelDepth("eventstore", storeWriter.Pending)
+		}
+		metricsServer, err := metrics.Listen(cfg.Metrics.Listen)
+		if err != nil {
+			sysutil.Log.Fatal("metrics init failed", zap.Error(err))
+		}
+		defer metricsServer.Close()
+	}
+
 	// 捕获操作系统信号，优雅关闭服务器或后台服务
 	sigCh := make(chan os.Signal, 1)
 	signal.Notify(sigCh, syscall.SIGINT, syscall.SIGTERM)
@@ -53,6 +186,7 @@ func main() {
 	for {
 		select {
 		case dev := <-usbEvents:
+			sinks.Publish(model.Event{Type: model.EventUSB, Time: dev.TimeStamp, USB: &dev})
 			if dev.Action == "add" {
 				sysutil.Log.Info("✅ USB Connected",
 					zap.String("mount", dev.MountPoint),
@@ -63,33 +197,118 @@ func main() {
 				)
 
 				// BadUSB 告警
-				if dev.DeviceType == "BADUSB_SUSPECT" {
+				if dev.DeviceType == model.DeviceTypeBadUSB {
 					sysutil.Log.Error("🚨 BADUSB DETECTED", zap.String("serial", dev.Serial))
+					sinks.Publish(model.Event{Type: model.EventAnalysis, Time: dev.TimeStamp, Analysis: &model.AnalysisEvent{
+						Analyzer:  config.AnalyzerBadUSB,
+						RiskLevel: "HIGH",
+						Message:   "storage device also exposes a HID interface",
+						Device:    dev.Context(),
+						TimeStamp: dev.TimeStamp,
+					}})
+				}
+
+				if dev.ReadOnly && !cfg.Audit() {
+					enforceReadOnly(dev, engine.ReadOnlyEnforcement())
 				}
 
-				if err := fileMon.AddWatch(dev.MountPoint); err != nil {
+				if err := fileMon.AddWatch(dev.Context()); err != nil {
 					sysutil.Log.Error("Failed to watch mount", zap.Error(err))
 				} else {
 					sysutil.Log.Info("👀 Monitoring started", zap.String("path", dev.MountPoint))
 				}
+				sessions.Start(dev.Context(), dev.TimeStamp)
 			} else if dev.Action == "remove" {
-				sysutil.Log.Info("❌ USB Removed", zap.String("path", dev.DevicePath))
+				sysutil.Log.Info("❌ USB Removed",
+					zap.String("dev", dev.DevicePath),
+					zap.String("mount", dev.MountPoint),
+					zap.String("vid", dev.IdVendor),
+					zap.String("pid", dev.IdProduct),
+					zap.String("serial", dev.Serial),
+					zap.String("product", dev.Product),
+					zap.String("session_id", dev.SessionID),
+					zap.Int("still_connected", devices.Len()),
+				)
+				fileMon.RemoveWatch(dev.MountPoint)
+				publishSession(sinks, sessions.End(dev.SessionID, dev.TimeStamp, session.EndRemoved))
 			}
 
 		// --- 文件事件 ---
 		case activity := <-fileMon.Events():
-			sysutil.Log.Info("📂 File Activity",
+			sinks.Publish(model.Event{Type: model.EventFile, Time: activity.TimeStamp, File: &activity})
+			sessions.Observe(activity)
+			fields := []zap.Field{
 				zap.String("op", activity.Operation),
 				zap.String("file", activity.FilePath),
 				zap.String("process", activity.ProcName), // 在操作的进程
-				zap.Int32("pid", activity.PID),           // PID
-			)
+				zap.Int32("process_pid", activity.PID),   // PID (与设备的 pid 区分)
+			}
+			if activity.Verdict != "" {
+				fields = append(fields, zap.String("verdict", activity.Verdict), zap.String("reason", activity.Reason))
+			}
+			if d := activity.Device; d != nil {
+				fields = append(fields, zap.String("serial", d.Serial), zap.String("session_id", d.SessionID))
+			}
+			if activity.Verdict == model.VerdictDeny || activity.Verdict == model.VerdictWouldDeny {
+				sysutil.Log.Warn("⛔ File Access Denied", fields...)
+			} else {
+				sysutil.Log.Info("📂 File Activity", fields...)
+			}
+
+		// --- 分析结果 ---
+		case finding := <-fileMon.Findings():
+			sinks.Publish(model.Event{Type: model.EventAnalysis, Time: finding.TimeStamp, Analysis: &finding})
 
 		case <-sigCh:
 			sysutil.Log.Info("Shutting down...")
+			for _, sum := range sessions.EndAll(time.Now(), session.EndAgentStopped) {
+				publishSession(sinks, sum)
+			}
 			return
 		}
 
 	}
 
 }
+
+// publishSession 记录并发出会话汇总
+func publishSession(sinks *sink.Fanout, sum *model.SessionSummary) {
+	if sum == nil {
+		return
+	}
+	sysutil.Log.Info("📋 USB session summary",
+		zap.String("session_id", sum.SessionID),
+		zap.String("serial", sum.Device.Serial),
+		zap.String("mount", sum.Device.MountPoint),
+		zap.Float64("duration_seconds", sum.DurationSeconds),
+		zap.Int("files_created", sum.FilesCreated),
+		zap.Int("files_written", sum.FilesWritten),
+		zap.Int("files_deleted", sum.FilesDeleted),
+		zap.Int("files_renamed", sum.FilesRenamed),
+		zap.Int64("written_files_size", sum.WrittenFilesSize),
+		zap.Int("denied", sum.Denied),
+		zap.String("end_reason", sum.EndReason),
+	)
+	sinks.Publish(model.Event{Type: model.EventSession, Time: sum.RemovedAt, Session: sum})
+}
+
+// enforceReadOnly 按配置对只读设备做文件系统/块设备层面的只读处理
+// fanotify 层的写拦截由 monitor 负责，这里只处理 remount / blockdev
+func enforceReadOnly(dev model.USBEvent, enforcement string) {
+	sysutil.Log.Warn("🔏 Read-only device",
+		zap.String("mount", dev.MountPoint),
+		zap.String("serial", dev.Serial),
+		zap.String("enforcement", enforcement),
+	)
+
+	if enforcement == policy.ReadOnlyBlockDev {
+		if err := sysutil.SetBlockDeviceReadOnly(dev.DevicePath); err != nil {
+			sysutil.Log.Error("Failed to set block device read-only", zap.Error(err))
+		}
+	}
+	if enforcement == policy.ReadOnlyRemount || enforcement == policy.ReadOnlyBlockDev {
+		if err := sysutil.RemountReadOnly(dev.MountPoint); err != nil {
+			sysutil.Log.Error("Failed to remount read-only", zap.Error(err))
+		}
+	}
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/Hara602/usbSentry/internal/quarantine"
+)
+
+// runQuarantine usbSentry quarantine list|restore|purge
+func runQuarantine(args []string) int {
+	if len(args) == 0 {
+		usage()
+		return 2
+	}
+
+	fs := flag.NewFlagSet("quarantine "+args[0], flag.ContinueOnError)
+	dir := fs.String("vault", loadCommandConfig().Quarantine.Dir, "quarantine directory")
+	to := fs.String("to", "", "restore: destination path (default: original path)")
+	force := fs.Bool("force", false, "restore: overwrite an existing destination")
+	all := fs.Bool("all", false, "purge: delete every quarantined file")
+	olderThan := fs.Duration("older-than", 0, "purge: delete files quarantined longer ago than this, e.g. 720h")
+	ids, err := parseArgs(fs, args[1:])
+	if err != nil {
+		return 2
+	}
+
+	store, err := quarantine.Open(*dir)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	switch args[0] {
+	case "list":
+		items, err := store.List()
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(tw, "ID\tTIME\tRISK\tTYPE\tDEVICE\tPROCESS\tREMOVED\tPATH")
+		for _, it := range items {
+			fmt.Fprintf(tw, "%s\t%s\t%s\t%s->%s\t%s:%s/%s\t%s(%d)\t%v\t%s\n",
+				it.ID, it.QuarantinedAt.Format(time.RFC3339), it.RiskLevel,
+				it.RealExt, it.DeclaredExt,
+				it.Device.Vid, it.Device.Pid, it.Device.Serial,
+				it.ProcName, it.PID, it.Removed, it.OriginalPath)
+		}
+		tw.Flush()
+
+	case "restore":
+		if len(ids) != 1 {
+			fmt.Fprintln(os.Stderr, "usage: usbSentry quarantine restore [-to path] [-force] <id>")
+			return 2
+		}
+		dest, err := store.Restore(ids[0], *to, *force)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		fmt.Printf("restored %s -> %s\n", ids[0], dest)
+
+	case "purge":
+		switch {
+		case *all || *olderThan > 0:
+			cutoff := time.Now().Add(-*olderThan)
+			n, err := store.PurgeOlderThan(cutoff)
+			if err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				return 1
+			}
+			fmt.Printf("purged %d item(s)\n", n)
+		case len(ids) > 0:
+			for _, id := range ids {
+				if err := store.Purge(id); err != nil {
+					fmt.Fprintln(os.Stderr, err)
+					return 1
+				}
+				fmt.Printf("purged %s\n", id)
+			}
+		default:
+			fmt.Fprintln(os.Stderr, "usage: usbSentry quarantine purge <id>... | -all | -older-than <duration>")
+			return 2
+		}
+
+	default:
+		fmt.Fprintf(os.Stderr, "unknown quarantine command %q\n", args[0])
+		return 2
+	}
+	return 0
+}
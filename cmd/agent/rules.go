@@ -0,0 +1,307 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/Hara602/usbSentry/internal/blackwhitelist"
+)
+
+// CSV 导入导出的列顺序
+var ruleCSVHeader = []string{"vid", "pid", "serial", "product", "list_type", "priority", "reason", "granted_by", "expires_at"}
+
+// runRules usbSentry rules add|remove|list|import|export|mode
+func runRules(args []string) int {
+	if len(args) == 0 {
+		usage()
+		return 2
+	}
+
+	fs := flag.NewFlagSet("rules "+args[0], flag.ContinueOnError)
+	dbPath := fs.String("db", loadCommandConfig().DBPath, "blackwhitelist database")
+	id := fs.Int64("id", 0, "remove: rule id (see rules list)")
+	vid := fs.String("vid", "", "vendor id, 4 hex digits (empty or * = any)")
+	pid := fs.String("pid", "", "product id, 4 hex digits (empty or * = any)")
+	serial := fs.String("serial", "", "serial number or glob, e.g. AA12*")
+	product := fs.String("product", "", "product string glob, case-insensitive, e.g. '*Cruzer*'")
+	listType := fs.String("type", blackwhitelist.ListDeny, "list type: allow, deny or readonly")
+	priority := fs.Int("priority", 0, "higher priority wins; ties go to the more specific rule")
+	reason := fs.String("reason", "", "free-form reason")
+	grantedBy := fs.String("granted-by", currentUser(), "who approved the rule")
+	expires := fs.Duration("expires", 0, "add: rule lifetime, e.g. 72h (0 = permanent)")
+	hours := fs.Float64("hours", 4, "exempt: exemption lifetime in hours")
+	format := fs.String("format", "", "list/import/export format: table, csv or json")
+	replace := fs.Bool("replace", false, "import: delete all existing rules first")
+	positional, err := parseArgs(fs, args[1:])
+	if err != nil {
+		return 2
+	}
+
+	if err := blackwhitelist.InitBlackWhiteDB(*dbPath); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	switch args[0] {
+	case "add":
+		r := blackwhitelist.Rule{Vid: *vid, Pid: *pid, Serial: *serial, Product: *product,
+			ListType: *listType, Priority: *priority, Reason: *reason, GrantedBy: *grantedBy}
+		if *expires > 0 {
+			t := time.Now().Add(*expires)
+			r.ExpiresAt = &t
+		}
+		if err := blackwhitelist.AddRule(r); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		fmt.Printf("added %s rule %s\n", r.ListType, describeRule(r))
+
+	case "exempt":
+		d := time.Duration(*hours * float64(time.Hour))
+		r, err := blackwhitelist.GrantTemporary(*vid, *pid, *serial, d, *grantedBy, *reason)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		fmt.Printf("exempted %s until %s (granted by %s)\n",
+			describeRule(r), r.ExpiresAt.Local().Format(time.DateTime), r.GrantedBy)
+
+	case "remove":
+		var found bool
+		var err error
+		r := blackwhitelist.Rule{Vid: *vid, Pid: *pid, Serial: *serial, Product: *product}
+		if *id > 0 {
+			found, err = blackwhitelist.RemoveRuleByID(*id)
+		} else {
+			found, err = blackwhitelist.RemoveRule(r)
+		}
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		if !found {
+			fmt.Fprintln(os.Stderr, "no such rule")
+			return 1
+		}
+		fmt.Println("rule removed")
+
+	case "list", "export":
+		rules, err := blackwhitelist.ListRules()
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		out := io.Writer(os.Stdout)
+		if args[0] == "export" && len(positional) > 0 && positional[0] != "-" {
+			f, err := os.Create(positional[0])
+			if err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				return 1
+			}
+			defer f.Close()
+			out = f
+		}
+		f := *format
+		if f == "" {
+			f = "table"
+			if args[0] == "export" {
+				f = formatFromPath(positional, "json")
+			}
+		}
+		if err := writeRules(out, f, rules); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+
+	case "import":
+		if len(positional) != 1 {
+			fmt.Fprintln(os.Stderr, "usage: usbSentry rules import [-format csv|json] [-replace] <file|->")
+			return 2
+		}
+		in := io.Reader(os.Stdin)
+		if positional[0] != "-" {
+			f, err := os.Open(positional[0])
+			if err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				return 1
+			}
+			defer f.Close()
+			in = f
+		}
+		f := *format
+		if f == "" {
+			f = formatFromPath(positional, "json")
+		}
+		rules, err := readRules(in, f)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		if err := blackwhitelist.ImportRules(rules, *replace); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		fmt.Printf("imported %d rule(s)\n", len(rules))
+
+	case "mode":
+		if len(positional) == 0 {
+			fmt.Println(blackwhitelist.GetMode())
+			return 0
+		}
+		if err := blackwhitelist.SetMode(positional[0]); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		fmt.Printf("mode set to %s\n", positional[0])
+
+	default:
+		fmt.Fprintf(os.Stderr, "unknown rules command %q\n", args[0])
+		return 2
+	}
+	return 0
+}
+
+// currentUser sudo 运行时取原始用户名
+func currentUser() string {
+	for _, k := range []string{"SUDO_USER", "USER"} {
+		if u := os.Getenv(k); u != "" {
+			return u
+		}
+	}
+	return ""
+}
+
+// describeRule vid:pid/serial [product]，未指定的字段显示为 *
+func describeRule(r blackwhitelist.Rule) string {
+	r.Validate()
+	s := fmt.Sprintf("%s:%s/%s", r.Vid, r.Pid, r.Serial)
+	if r.Product != blackwhitelist.Wildcard {
+		s += fmt.Sprintf(" product=%q", r.Product)
+	}
+	return s
+}
+
+// formatFromPath 根据文件后缀推断格式
+func formatFromPath(positional []string, def string) string {
+	if len(positional) > 0 && strings.EqualFold(filepath.Ext(positional[0]), ".csv") {
+		return "csv"
+	}
+	return def
+}
+
+func writeRules(w io.Writer, format string, rules []blackwhitelist.Rule) error {
+	switch format {
+	case "table":
+		tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(tw, "ID\tTYPE\tPRIO\tVID\tPID\tSERIAL\tPRODUCT\tCREATED\tEXPIRES\tGRANTED BY\tREASON")
+		for _, r := range rules {
+			expires := "never"
+			if r.ExpiresAt != nil {
+				expires = r.ExpiresAt.Local().Format(time.DateTime)
+				if r.Expired(time.Now()) {
+					expires += " (expired)"
+				}
+			}
+			fmt.Fprintf(tw, "%d\t%s\t%d\t%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\n",
+				r.ID, r.ListType, r.Priority, r.Vid, r.Pid, r.Serial, r.Product,
+				r.CreatedAt.Local().Format(time.DateTime), expires, r.GrantedBy, r.Reason)
+		}
+		return tw.Flush()
+
+	case "json":
+		if rules == nil {
+			rules = []blackwhitelist.Rule{}
+		}
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(rules)
+
+	case "csv":
+		cw := csv.NewWriter(w)
+		cw.Write(ruleCSVHeader)
+		for _, r := range rules {
+			expires := ""
+			if r.ExpiresAt != nil {
+				expires = r.ExpiresAt.UTC().Format(time.RFC3339)
+			}
+			cw.Write([]string{r.Vid, r.Pid, r.Serial, r.Product, r.ListType, strconv.Itoa(r.Priority), r.Reason, r.GrantedBy, expires})
+		}
+		cw.Flush()
+		return cw.Error()
+	}
+	return fmt.Errorf("unknown format %q", format)
+}
+
+func readRules(r io.Reader, format string) ([]blackwhitelist.Rule, error) {
+	switch format {
+	case "json":
+		var rules []blackwhitelist.Rule
+		if err := json.NewDecoder(r).Decode(&rules); err != nil {
+			return nil, fmt.Errorf("parse json failed: %w", err)
+		}
+		return rules, nil
+
+	case "csv":
+		cr := csv.NewReader(r)
+		cr.FieldsPerRecord = -1
+		records, err := cr.ReadAll()
+		if err != nil {
+			return nil, fmt.Errorf("parse csv failed: %w", err)
+		}
+		// 有表头时按列名取值 (兼容旧版 vid,pid,serial,list_type,reason)，没有表头按 ruleCSVHeader 的顺序
+		header := ruleCSVHeader
+		if len(records) > 0 && strings.EqualFold(records[0][0], "vid") {
+			header = records[0]
+			records = records[1:]
+		}
+		col := make(map[string]int, len(header))
+		for i, name := range header {
+			col[strings.ToLower(strings.TrimSpace(name))] = i
+		}
+		get := func(rec []string, name string) string {
+			if i, ok := col[name]; ok && i < len(rec) {
+				return rec[i]
+			}
+			return ""
+		}
+
+		rules := make([]blackwhitelist.Rule, 0, len(records))
+		for i, rec := range records {
+			rule := blackwhitelist.Rule{
+				Vid:       get(rec, "vid"),
+				Pid:       get(rec, "pid"),
+				Serial:    get(rec, "serial"),
+				Product:   get(rec, "product"),
+				ListType:  get(rec, "list_type"),
+				Reason:    get(rec, "reason"),
+				GrantedBy: get(rec, "granted_by"),
+			}
+			if p := get(rec, "priority"); p != "" {
+				n, err := strconv.Atoi(p)
+				if err != nil {
+					return nil, fmt.Errorf("csv line %d: invalid priority %q", i+1, p)
+				}
+				rule.Priority = n
+			}
+			if e := get(rec, "expires_at"); e != "" {
+				t, err := time.Parse(time.RFC3339, e)
+				if err != nil {
+					return nil, fmt.Errorf("csv line %d: invalid expires_at %q (want RFC 3339)", i+1, e)
+				}
+				rule.ExpiresAt = &t
+			}
+			rules = append(rules, rule)
+		}
+		return rules, nil
+	}
+	return nil, fmt.Errorf("unknown format %q", format)
+}
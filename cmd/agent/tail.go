@@ -0,0 +1,109 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+
+	"github.com/Hara602/usbSentry/internal/model"
+)
+
+// runTail usbSentry tail，通过控制 API 实时输出正在运行的 Agent 的事件
+func runTail(args []string) int {
+	fs := flag.NewFlagSet("tail", flag.ContinueOnError)
+	socket := fs.String("socket", loadCommandConfig().API.Socket, "agent control API socket")
+	typ := fs.String("type", "", "event type: usb, file, analysis or session (default all)")
+	device := fs.String("device", "", "device: serial number, /dev node, mount point or vid:pid")
+	session := fs.String("session", "", "insertion session id")
+	process := fs.String("process", "", "process name")
+	op := fs.String("op", "", "operation, e.g. CLOSE_WRITE, OPEN_PERM, add, remove")
+	pathGlob := fs.String("path", "", "path glob, * also matches /, e.g. '/media/*.exe'")
+	format := fs.String("format", "pretty", "output format: pretty or json")
+	if _, err := parseArgs(fs, args); err != nil {
+		return 2
+	}
+	if *format != "pretty" && *format != "json" {
+		fmt.Fprintf(os.Stderr, "unknown format %q\n", *format)
+		return 2
+	}
+
+	q := url.Values{}
+	for k, v := range map[string]string{"type": *typ, "device": *device, "session": *session, "process": *process, "op": *op, "path": *pathGlob} {
+		if v != "" {
+			q.Set(k, v)
+		}
+	}
+	resp, err := apiClient(*socket).Get("http://agent/v1/events/stream?" + q.Encode())
+	if err != nil {
+		fmt.Fprintln(os.Stderr, apiError(*socket, err))
+		return 1
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		fmt.Fprintf(os.Stderr, "agent returned %s: %s\n", resp.Status, strings.TrimSpace(string(body)))
+		return 1
+	}
+
+	sc := bufio.NewScanner(resp.Body)
+	sc.Buffer(make([]byte, 64*1024), 1024*1024)
+	for sc.Scan() {
+		if *format == "json" {
+			fmt.Println(sc.Text())
+			continue
+		}
+		var ev model.Event
+		if err := json.Unmarshal(sc.Bytes(), &ev); err != nil {
+			fmt.Fprintln(os.Stderr, "bad event:", err)
+			continue
+		}
+		fmt.Println(prettyEvent(ev))
+	}
+	if err := sc.Err(); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+	} else {
+		fmt.Fprintln(os.Stderr, "agent closed the stream")
+	}
+	return 1
+}
+
+// prettyEvent 单行输出，字段同 events query 的表格，省略空列
+func prettyEvent(ev model.Event) string {
+	var cols []string
+	for _, c := range eventRow(ev) {
+		if c != "" {
+			cols = append(cols, c)
+		}
+	}
+	return strings.Join(cols, "  ")
+}
+
+// apiClient 通过 unix socket 访问控制 API 的 HTTP 客户端，URL 中的 host 会被忽略
+func apiClient(socket string) *http.Client {
+	return &http.Client{Transport: &http.Transport{
+		DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+			var d net.Dialer
+			return d.DialContext(ctx, "unix", socket)
+		},
+	}}
+}
+
+// apiError 把常见的连接错误转换成提示
+func apiError(socket string, err error) error {
+	switch {
+	case errors.Is(err, os.ErrPermission):
+		return fmt.Errorf("permission denied on %s: run as root or as a member of api.group", socket)
+	case errors.Is(err, os.ErrNotExist):
+		return fmt.Errorf("%s not found: is the agent running with the control API enabled?", socket)
+	}
+	return err
+}
@@ -4,13 +4,15 @@ import (
 	"os"
 	"path/filepath"
 	"strings"
+
+	"github.com/Hara602/usbSentry/internal/model"
 )
 
 // CheckBadUSB 如果一个 USB 设备树下同时拥有 08(存储) 和 03(HID) 接口，则判定为 BadUSB
 func CheckBadUSB(sysPath string) (bool, string) {
 	files, err := os.ReadDir(sysPath)
 	if err != nil {
-		return false, "unknown"
+		return false, model.DeviceTypeUnknown
 	}
 	hasStorage := false
 	hasHID := false
@@ -29,9 +31,9 @@ func CheckBadUSB(sysPath string) (bool, string) {
 		}
 	}
 	if hasStorage && hasHID {
-		return true, "BADUSB_SUSPECT"
+		return true, model.DeviceTypeBadUSB
 	} else if hasStorage {
-		return false, "udisk"
+		return false, model.DeviceTypeUDisk
 	}
-	return false, "other"
+	return false, model.DeviceTypeOther
 }
@@ -0,0 +1,119 @@
+package api
+
+import (
+	"net/url"
+	"regexp"
+	"strings"
+
+	"github.com/Hara602/usbSentry/internal/model"
+)
+
+// eventFilter /v1/events 和 /v1/events/stream 共用的过滤条件，空字段不过滤
+type eventFilter struct {
+	typ     string
+	device  string // 序列号、设备节点 (/dev/sdb1)、挂载点或 vid:pid
+	serial  string
+	session string
+	process string
+	op      string         // 子串匹配，忽略大小写
+	path    *regexp.Regexp // glob，* 也匹配 /，与 events query -path 一致
+}
+
+func newEventFilter(q url.Values) eventFilter {
+	f := eventFilter{
+		typ:     q.Get("type"),
+		device:  q.Get("device"),
+		serial:  q.Get("serial"),
+		session: q.Get("session"),
+		process: q.Get("process"),
+		op:      strings.ToUpper(q.Get("op")),
+	}
+	if p := q.Get("path"); p != "" {
+		f.path = globRegexp(p)
+	}
+	return f
+}
+
+func (f eventFilter) match(ev model.Event) bool {
+	if f.typ != "" && ev.Type != f.typ {
+		return false
+	}
+	dev := ev.Device()
+	if f.serial != "" && (dev == nil || dev.Serial != f.serial) {
+		return false
+	}
+	if f.session != "" && (dev == nil || dev.SessionID != f.session) {
+		return false
+	}
+	if f.device != "" && (dev == nil || !deviceMatch(*dev, f.device)) {
+		return false
+	}
+	if f.process != "" && eventProcess(ev) != f.process {
+		return false
+	}
+	if f.op != "" && !strings.Contains(strings.ToUpper(eventOp(ev)), f.op) {
+		return false
+	}
+	if f.path == nil {
+		return true
+	}
+	// 改名事件的原路径也算
+	return f.path.MatchString(eventPath(ev)) || (ev.File != nil && ev.File.OldPath != "" && f.path.MatchString(ev.File.OldPath))
+}
+
+func deviceMatch(dev model.DeviceContext, s string) bool {
+	if vid, pid, ok := strings.Cut(s, ":"); ok {
+		return strings.EqualFold(dev.Vid, vid) && strings.EqualFold(dev.Pid, pid)
+	}
+	return s == dev.Serial || s == dev.DevPath || (dev.MountPoint != "" && s == dev.MountPoint)
+}
+
+// globRegexp 把 glob 转换成正则：* 匹配任意字符 (包括 /)，? 匹配单个字符
+func globRegexp(glob string) *regexp.Regexp {
+	var b strings.Builder
+	b.WriteString("^")
+	for _, r := range glob {
+		switch r {
+		case '*':
+			b.WriteString(".*")
+		case '?':
+			b.WriteString(".")
+		default:
+			b.WriteString(regexp.QuoteMeta(string(r)))
+		}
+	}
+	b.WriteString("$")
+	return regexp.MustCompile(b.String())
+}
+
+func eventProcess(ev model.Event) string {
+	switch {
+	case ev.File != nil:
+		return ev.File.ProcName
+	case ev.Analysis != nil:
+		return ev.Analysis.ProcName
+	}
+	return ""
+}
+
+func eventOp(ev model.Event) string {
+	switch {
+	case ev.USB != nil:
+		return ev.USB.Action
+	case ev.File != nil:
+		return ev.File.Operation
+	}
+	return ""
+}
+
+func eventPath(ev model.Event) string {
+	switch {
+	case ev.USB != nil:
+		return ev.USB.MountPoint
+	case ev.File != nil:
+		return ev.File.FilePath
+	case ev.Analysis != nil:
+		return ev.Analysis.FilePath
+	}
+	return ""
+}
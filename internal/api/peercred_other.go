@@ -0,0 +1,13 @@
+//go:build !linux
+
+package api
+
+import (
+	"context"
+	"net"
+	"net/http"
+)
+
+func withPeer(ctx context.Context, c net.Conn) context.Context { return ctx }
+
+func peerName(r *http.Request) string { return "api" }
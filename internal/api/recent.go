@@ -0,0 +1,95 @@
+package api
+
+import (
+	"sync"
+
+	"github.com/Hara602/usbSentry/internal/model"
+)
+
+// Recent 最近事件的环形缓冲区，实现 sink.Sink，挂在 Fanout 上接收所有事件
+// 不依赖事件库，关闭 events.db_path 时 API 也能查到最近的事件
+type Recent struct {
+	mu   sync.RWMutex
+	buf  []model.Event
+	next int  // 下一个写入位置
+	full bool // 是否已经绕回
+	subs map[*subscriber]struct{}
+}
+
+// subscriber 实时事件流的订阅者
+type subscriber struct {
+	ch      chan model.Event
+	dropped int // 订阅者读得太慢时丢弃的事件数
+}
+
+func NewRecent(capacity int) *Recent {
+	if capacity <= 0 {
+		capacity = 1000
+	}
+	return &Recent{buf: make([]model.Event, capacity), subs: make(map[*subscriber]struct{})}
+}
+
+func (r *Recent) Name() string { return "api-recent" }
+
+func (r *Recent) Close() error { return nil }
+
+func (r *Recent) Send(ev model.Event) error {
+	r.mu.Lock()
+	r.buf[r.next] = ev
+	r.next = (r.next + 1) % len(r.buf)
+	if r.next == 0 {
+		r.full = true
+	}
+	// 不能因为某个订阅者读得慢而阻塞 Fanout，队列满时丢弃
+	for sub := range r.subs {
+		select {
+		case sub.ch <- ev:
+		default:
+			sub.dropped++
+		}
+	}
+	r.mu.Unlock()
+	return nil
+}
+
+// Subscribe 订阅之后的所有事件，用完必须调用 cancel；返回的 dropped 为订阅期间丢弃的事件数
+func (r *Recent) Subscribe(buffer int) (<-chan model.Event, func() (dropped int)) {
+	sub := &subscriber{ch: make(chan model.Event, buffer)}
+	r.mu.Lock()
+	r.subs[sub] = struct{}{}
+	r.mu.Unlock()
+	return sub.ch, func() int {
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		delete(r.subs, sub)
+		return sub.dropped
+	}
+}
+
+// Last 按时间正序返回最近 limit 条 (limit <= 0 表示全部) 满足 match 的事件
+func (r *Recent) Last(limit int, match func(model.Event) bool) []model.Event {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	n := r.next
+	if r.full {
+		n = len(r.buf)
+	}
+	// 从最新的往回找
+	var out []model.Event
+	for i := 0; i < n; i++ {
+		idx := (r.next - 1 - i + len(r.buf)) % len(r.buf)
+		ev := r.buf[idx]
+		if match != nil && !match(ev) {
+			continue
+		}
+		out = append(out, ev)
+		if limit > 0 && len(out) == limit {
+			break
+		}
+	}
+	for i, j := 0, len(out)-1; i < j; i, j = i+1, j-1 {
+		out[i], out[j] = out[j], out[i]
+	}
+	return out
+}
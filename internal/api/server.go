@@ -0,0 +1,343 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net"
+	"net/http"
+	"os"
+	"os/user"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Hara602/usbSentry/internal/blackwhitelist"
+	"github.com/Hara602/usbSentry/internal/metrics"
+	"github.com/Hara602/usbSentry/internal/model"
+	"github.com/Hara602/usbSentry/internal/registry"
+	"github.com/Hara602/usbSentry/internal/sysutil"
+	"go.uber.org/zap"
+)
+
+// Config API 服务依赖的组件
+type Config struct {
+	Socket   string             // unix socket 路径
+	Group    string             // 允许访问的用户组，为空时只有 root 能访问 (0600)
+	Mode     string             // 执行模式 (enforce / audit)，用于 status
+	Registry *registry.Registry // 当前已连接的设备
+	Recent   *Recent            // 最近事件
+}
+
+// Server 本地控制 API (HTTP over unix socket)
+type Server struct {
+	cfg     Config
+	started time.Time
+	srv     *http.Server
+	ln      net.Listener
+	done    chan struct{} // 关闭时结束所有事件流
+}
+
+// 每个事件流连接的缓冲，客户端读得慢时超出部分丢弃
+const streamBuffer = 256
+
+// Status GET /v1/status 的返回
+type Status struct {
+	PID              int       `json:"pid"`
+	StartedAt        time.Time `json:"started_at"`
+	UptimeSeconds    float64   `json:"uptime_seconds"`
+	Mode             string    `json:"mode"`
+	DeviceMode       string    `json:"device_mode"`
+	ConnectedDevices int       `json:"connected_devices"`
+}
+
+// Listen 创建 socket 并开始服务
+func Listen(cfg Config) (*Server, error) {
+	if err := os.MkdirAll(filepath.Dir(cfg.Socket), 0755); err != nil {
+		return nil, fmt.Errorf("create socket dir failed: %w", err)
+	}
+	// 上次异常退出留下的 socket 文件会导致 bind 失败
+	if fi, err := os.Lstat(cfg.Socket); err == nil {
+		if fi.Mode().Type() != fs.ModeSocket {
+			return nil, fmt.Errorf("%s exists and is not a socket", cfg.Socket)
+		}
+		os.Remove(cfg.Socket)
+	}
+
+	ln, err := net.Listen("unix", cfg.Socket)
+	if err != nil {
+		return nil, fmt.Errorf("listen on %s failed: %w", cfg.Socket, err)
+	}
+	if err := restrictSocket(cfg.Socket, cfg.Group); err != nil {
+		ln.Close()
+		return nil, err
+	}
+
+	s := &Server{cfg: cfg, started: time.Now(), ln: ln, done: make(chan struct{})}
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /v1/status", s.status)
+	mux.HandleFunc("GET /v1/devices", s.devices)
+	mux.HandleFunc("POST /v1/devices/block", s.block)
+	mux.HandleFunc("POST /v1/devices/unblock", s.unblock)
+	mux.HandleFunc("GET /v1/events", s.events)
+	mux.HandleFunc("GET /v1/events/stream", s.stream)
+	mux.HandleFunc("GET /v1/rules", s.listRules)
+	mux.HandleFunc("POST /v1/rules", s.addRule)
+	mux.HandleFunc("DELETE /v1/rules/{id}", s.removeRule)
+	mux.HandleFunc("POST /v1/rules/exempt", s.exempt)
+	s.srv = &http.Server{
+		Handler:           mux,
+		ReadHeaderTimeout: 5 * time.Second,
+		ConnContext:       withPeer,
+	}
+
+	go func() {
+		if err := s.srv.Serve(ln); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			sysutil.Log.Error("api server stopped", zap.Error(err))
+		}
+	}()
+	sysutil.Log.Info("🔌 Control API listening", zap.String("socket", cfg.Socket), zap.String("group", cfg.Group))
+	return s, nil
+}
+
+// restrictSocket socket 属主为 root，权限 0600；指定 group 时放开给该组 (0660)
+func restrictSocket(path, group string) error {
+	if group == "" {
+		return os.Chmod(path, 0600)
+	}
+	g, err := user.LookupGroup(group)
+	if err != nil {
+		return fmt.Errorf("api group: %w", err)
+	}
+	gid, _ := strconv.Atoi(g.Gid)
+	if err := os.Chown(path, 0, gid); err != nil {
+		return fmt.Errorf("chown socket failed: %w", err)
+	}
+	return os.Chmod(path, 0660)
+}
+
+// Close 停止服务并删除 socket 文件
+func (s *Server) Close() error {
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	close(s.done)
+	err := s.srv.Shutdown(ctx)
+	os.Remove(s.cfg.Socket)
+	return err
+}
+
+func (s *Server) status(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, Status{
+		PID:              os.Getpid(),
+		StartedAt:        s.started,
+		UptimeSeconds:    time.Since(s.started).Seconds(),
+		Mode:             s.cfg.Mode,
+		DeviceMode:       blackwhitelist.GetMode(),
+		ConnectedDevices: s.cfg.Registry.Len(),
+	})
+}
+
+func (s *Server) devices(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, s.cfg.Registry.List())
+}
+
+// blockRequest 手动阻断/放行，bus_id 与 device_path (已连接的分区) 二选一
+type blockRequest struct {
+	BusID      string `json:"bus_id"`
+	DevicePath string `json:"device_path"`
+}
+
+func (s *Server) busID(r *http.Request) (string, error) {
+	var req blockRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		return "", fmt.Errorf("invalid request body: %w", err)
+	}
+	if req.BusID != "" {
+		return req.BusID, nil
+	}
+	if req.DevicePath == "" {
+		return "", errors.New("bus_id or device_path is required")
+	}
+	ev, ok := s.cfg.Registry.Get(req.DevicePath)
+	if !ok || ev.SysPath == "" {
+		return "", fmt.Errorf("device %s is not connected", req.DevicePath)
+	}
+	return filepath.Base(ev.SysPath), nil
+}
+
+func (s *Server) block(w http.ResponseWriter, r *http.Request) {
+	id, err := s.busID(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	if err := blackwhitelist.BlockDevice(id); err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	metrics.DevicesBlocked.WithLabelValues("api").Inc()
+	sysutil.Log.Warn("🚫 Device blocked via API", zap.String("bus_id", id), zap.String("by", peerName(r)))
+	writeJSON(w, http.StatusOK, map[string]string{"bus_id": id, "result": "blocked"})
+}
+
+func (s *Server) unblock(w http.ResponseWriter, r *http.Request) {
+	id, err := s.busID(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	if err := blackwhitelist.UnblockDevice(id); err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	sysutil.Log.Warn("✅ Device unblocked via API", zap.String("bus_id", id), zap.String("by", peerName(r)))
+	writeJSON(w, http.StatusOK, map[string]string{"bus_id": id, "result": "unblocked"})
+}
+
+// events GET /v1/events?limit=100&type=file&device=..&serial=..&session=..&process=..&op=..&path=..
+func (s *Server) events(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	limit := 100
+	if v := q.Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			writeError(w, http.StatusBadRequest, fmt.Errorf("invalid limit %q", v))
+			return
+		}
+		limit = n
+	}
+	events := s.cfg.Recent.Last(limit, newEventFilter(q).match)
+	if events == nil {
+		events = []model.Event{}
+	}
+	writeJSON(w, http.StatusOK, events)
+}
+
+// stream GET /v1/events/stream 实时事件流 (NDJSON，每行一个事件)，过滤参数同 /v1/events
+func (s *Server) stream(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		writeError(w, http.StatusInternalServerError, errors.New("streaming not supported"))
+		return
+	}
+	filter := newEventFilter(r.URL.Query())
+	events, cancel := s.cfg.Recent.Subscribe(streamBuffer)
+	defer func() {
+		if dropped := cancel(); dropped > 0 {
+			sysutil.Log.Warn("event stream client too slow, events dropped", zap.Int("dropped", dropped), zap.String("by", peerName(r)))
+		}
+	}()
+
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	enc := json.NewEncoder(w)
+	for {
+		select {
+		case ev := <-events:
+			if !filter.match(ev) {
+				continue
+			}
+			if err := enc.Encode(ev); err != nil {
+				return
+			}
+			flusher.Flush()
+		case <-r.Context().Done():
+			return
+		case <-s.done:
+			return
+		}
+	}
+}
+
+func (s *Server) listRules(w http.ResponseWriter, r *http.Request) {
+	rules, err := blackwhitelist.ListRules()
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	if rules == nil {
+		rules = []blackwhitelist.Rule{}
+	}
+	writeJSON(w, http.StatusOK, rules)
+}
+
+func (s *Server) addRule(w http.ResponseWriter, r *http.Request) {
+	var rule blackwhitelist.Rule
+	if err := json.NewDecoder(r.Body).Decode(&rule); err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("invalid request body: %w", err))
+		return
+	}
+	rule.ID = 0
+	if rule.GrantedBy == "" {
+		rule.GrantedBy = peerName(r)
+	}
+	if err := blackwhitelist.AddRule(rule); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	rule.Validate()
+	sysutil.Log.Info("Rule added via API", zap.String("list", rule.ListType), zap.String("by", rule.GrantedBy))
+	writeJSON(w, http.StatusCreated, rule)
+}
+
+func (s *Server) removeRule(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("invalid rule id %q", r.PathValue("id")))
+		return
+	}
+	found, err := blackwhitelist.RemoveRuleByID(id)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	if !found {
+		writeError(w, http.StatusNotFound, errors.New("no such rule"))
+		return
+	}
+	sysutil.Log.Info("Rule removed via API", zap.Int64("id", id), zap.String("by", peerName(r)))
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// exemptRequest 临时豁免，参数同 usbSentry rules exempt
+type exemptRequest struct {
+	Vid       string  `json:"vid"`
+	Pid       string  `json:"pid"`
+	Serial    string  `json:"serial"`
+	Hours     float64 `json:"hours"`
+	GrantedBy string  `json:"granted_by"`
+	Reason    string  `json:"reason"`
+}
+
+func (s *Server) exempt(w http.ResponseWriter, r *http.Request) {
+	var req exemptRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("invalid request body: %w", err))
+		return
+	}
+	if req.GrantedBy == "" {
+		req.GrantedBy = peerName(r)
+	}
+	rule, err := blackwhitelist.GrantTemporary(req.Vid, req.Pid, req.Serial,
+		time.Duration(req.Hours*float64(time.Hour)), req.GrantedBy, req.Reason)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	writeJSON(w, http.StatusCreated, rule)
+}
+
+func writeJSON(w http.ResponseWriter, code int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, code int, err error) {
+	writeJSON(w, code, map[string]string{"error": strings.TrimSpace(err.Error())})
+}
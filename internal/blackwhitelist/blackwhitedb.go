@@ -2,67 +2,370 @@ package blackwhitelist
 
 import (
 	"database/sql"
+	"errors"
 	"fmt"
+	"path"
+	"regexp"
+	"strings"
+	"time"
 
-	_ "modernc.org/sqlite"
+	"github.com/Hara602/usbSentry/internal/model"
+	"github.com/Hara602/usbSentry/internal/sqlitedb"
+	"github.com/Hara602/usbSentry/internal/sysutil"
+	"go.uber.org/zap"
 )
 
 var BWdb *sql.DB
 
-// InitBlackWhiteDB 初始化数据库表结构
-func InitBlackWhiteDB(dbPath string) error {
-	var err error
-	BWdb, err = sql.Open("sqlite", dbPath)
-	if err != nil {
-		return fmt.Errorf("failed to open database: %w", err)
-	}
+// BlockEmptySerial 是否阻断空序列号或全 0 序列号的设备 (由配置 enforcement.block_empty_serial 控制)
+var BlockEmptySerial = true
+
+// 名单类型 (list_type 列)
+const (
+	ListAllow    = "allow"    // 白名单
+	ListDeny     = "deny"     // 黑名单
+	ListReadOnly = "readonly" // 允许接入，但只能读不能写
+)
+
+// 全局模式：未命中任何规则时的默认动作
+const (
+	ModeDefaultAllow = "default-allow" // 默认放行，仅拦截黑名单 (兼容旧行为)
+	ModeDefaultDeny  = "default-deny"  // 默认阻断，仅放行白名单 (锁定工作站)
+)
+
+// Wildcard 规则字段取这个值时匹配任意设备
+const Wildcard = "*"
+
+// Rule 一条黑白名单规则
+// 匹配层级：整个厂商 (vid) > 某个型号 (vid+pid) > 序列号 glob > 具体设备 (vid+pid+serial)，
+// product 为产品名 glob (忽略大小写)。未指定的字段为 "*"
+type Rule struct {
+	ID        int64      `json:"id,omitempty"`
+	Vid       string     `json:"vid"`
+	Pid       string     `json:"pid"`
+	Serial    string     `json:"serial"`
+	Product   string     `json:"product"`
+	ListType  string     `json:"list_type"` // ListAllow / ListDeny / ListReadOnly
+	Priority  int        `json:"priority"`  // 越大越优先，相同优先级时越具体的规则胜出
+	Reason    string     `json:"reason,omitempty"`
+	GrantedBy string     `json:"granted_by,omitempty"` // 谁添加/批准的这条规则
+	ExpiresAt *time.Time `json:"expires_at,omitempty"` // 到期后自动失效并被清理，nil 表示永久
+	CreatedAt time.Time  `json:"created_at,omitempty"`
+}
+
+// Expired 判断规则在 now 时刻是否已过期
+func (r *Rule) Expired(now time.Time) bool {
+	return r.ExpiresAt != nil && !r.ExpiresAt.After(now)
+}
 
-	// 联合主键 (vid, pid, serial) 防止重复
-	schema := `
-	CREATE TABLE IF NOT EXISTS blackwhitelist (
+// Decision IsBlocked 的结构化裁决结果
+type Decision struct {
+	Blocked  bool
+	ReadOnly bool // 放行但禁止写入
+	Reason   string
+	Mode     string // 裁决时生效的全局模式
+	Rule     *Rule  // 命中的规则，未命中任何规则时为 nil
+}
+
+// migrations 按顺序执行的表结构变更，版本号记录在 PRAGMA user_version 中
+var migrations = []string{
+	// v1: 联合主键 (vid, pid, serial) 防止重复
+	`CREATE TABLE IF NOT EXISTS blackwhitelist (
 		vid TEXT,
 		pid TEXT,
 		serial TEXT,
 		reason TEXT,
 		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
 		PRIMARY KEY (vid, pid, serial)
+	);`,
+	// v2: 名单类型 + 全局设置 (旧数据全部视为黑名单)
+	`ALTER TABLE blackwhitelist ADD COLUMN list_type TEXT NOT NULL DEFAULT 'deny';
+	CREATE TABLE IF NOT EXISTS settings (
+		key TEXT PRIMARY KEY,
+		value TEXT
+	);`,
+	// v3: 通配符规则 + 优先级，主键改为自增 id
+	`CREATE TABLE blackwhitelist_v3 (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		vid TEXT NOT NULL DEFAULT '*',
+		pid TEXT NOT NULL DEFAULT '*',
+		serial TEXT NOT NULL DEFAULT '*',
+		product TEXT NOT NULL DEFAULT '*',
+		list_type TEXT NOT NULL DEFAULT 'deny',
+		priority INTEGER NOT NULL DEFAULT 0,
+		reason TEXT,
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		UNIQUE (vid, pid, serial, product)
+	);
+	INSERT INTO blackwhitelist_v3 (vid, pid, serial, list_type, reason, created_at)
+		SELECT IFNULL(vid, ''), IFNULL(pid, ''), IFNULL(serial, ''), list_type, reason, created_at FROM blackwhitelist;
+	DROP TABLE blackwhitelist;
+	ALTER TABLE blackwhitelist_v3 RENAME TO blackwhitelist;
+	CREATE INDEX IF NOT EXISTS idx_blackwhitelist_vid ON blackwhitelist (vid);`,
+	// v4: 过期时间 (UTC，格式同 CURRENT_TIMESTAMP，便于在 SQL 里直接比较) + 批准人
+	`ALTER TABLE blackwhitelist ADD COLUMN expires_at DATETIME;
+	ALTER TABLE blackwhitelist ADD COLUMN granted_by TEXT;`,
+	// v5: 历史设备清单，每个见过的 USB 设备一行
+	`CREATE TABLE IF NOT EXISTS device_inventory (
+		vid TEXT NOT NULL,
+		pid TEXT NOT NULL,
+		serial TEXT NOT NULL,
+		product TEXT,
+		manufacturer TEXT,
+		first_seen DATETIME NOT NULL,
+		last_seen DATETIME NOT NULL,
+		insert_count INTEGER NOT NULL DEFAULT 0,
+		last_verdict TEXT,
+		last_reason TEXT,
+		PRIMARY KEY (vid, pid, serial)
 	);
-	`
-	_, err = BWdb.Exec(schema)
+	CREATE INDEX IF NOT EXISTS idx_device_inventory_serial ON device_inventory (serial);`,
+}
+
+// ruleColumns SELECT 规则时的列顺序，与 scanRule 对应
+const ruleColumns = "id, vid, pid, serial, product, list_type, priority, IFNULL(reason, ''), IFNULL(granted_by, ''), expires_at, created_at"
+
+type rowScanner interface {
+	Scan(dest ...any) error
+}
+
+func scanRule(row rowScanner) (Rule, error) {
+	var r Rule
+	var expires sql.NullTime
+	err := row.Scan(&r.ID, &r.Vid, &r.Pid, &r.Serial, &r.Product, &r.ListType, &r.Priority, &r.Reason, &r.GrantedBy, &expires, &r.CreatedAt)
+	if expires.Valid {
+		r.ExpiresAt = &expires.Time
+	}
+	return r, err
+}
+
+// dbTime 把时间转换成与 CURRENT_TIMESTAMP 相同的格式，nil 对应 NULL
+func dbTime(t *time.Time) any {
+	if t == nil {
+		return nil
+	}
+	return t.UTC().Format(time.DateTime)
+}
+
+// InitBlackWhiteDB 初始化数据库表结构
+func InitBlackWhiteDB(dbPath string) error {
+	var err error
+	BWdb, err = sqlitedb.Open(dbPath)
 	if err != nil {
+		return fmt.Errorf("failed to open database: %w", err)
+	}
+
+	if err := sqlitedb.Migrate(BWdb, migrations); err != nil {
 		return fmt.Errorf("failed to create table: %w", err)
 	}
 	return nil
 }
 
-func IsBlocked(vid, pid, serial string) (bool, string) {
-	// 无序列号直接阻断 (硬编码的高危规则)
-	if serial == "" || serial == "000000000000" {
-		return true, "Unknown or empty serial number"
+// GetMode 读取全局模式，未设置时为 ModeDefaultAllow
+func GetMode() string {
+	if BWdb == nil {
+		return ModeDefaultAllow
+	}
+	var mode string
+	err := BWdb.QueryRow("SELECT value FROM settings WHERE key = 'mode'").Scan(&mode)
+	if err != nil || (mode != ModeDefaultAllow && mode != ModeDefaultDeny) {
+		return ModeDefaultAllow
+	}
+	return mode
+}
+
+// SetMode 切换全局模式
+func SetMode(mode string) error {
+	if mode != ModeDefaultAllow && mode != ModeDefaultDeny {
+		return fmt.Errorf("invalid mode %q (want %s or %s)", mode, ModeDefaultAllow, ModeDefaultDeny)
+	}
+	if BWdb == nil {
+		return errors.New("blackwhitelist database not initialized")
+	}
+	_, err := BWdb.Exec("INSERT OR REPLACE INTO settings(key, value) VALUES ('mode', ?)", mode)
+	return err
+}
+
+// IsBlocked 裁决设备是否允许接入
+// 多条规则同时命中时：priority 高者胜；相同则更具体者胜；仍相同则 deny > readonly > allow
+func IsBlocked(dev model.Device) Decision {
+	mode := GetMode()
+
+	// 查数据库黑白名单，查询失败时阻断 (fail closed)，否则默认放行模式下黑名单设备会被放进来
+	rule, err := bestMatch(dev)
+	if err != nil {
+		sysutil.Log.Error("blacklist lookup failed, blocking device",
+			zap.String("vid", dev.Vid), zap.String("pid", dev.Pid), zap.String("serial", dev.Serial), zap.Error(err))
+		return Decision{Blocked: true, Reason: "Rule lookup failed: " + err.Error(), Mode: mode}
+	}
+	if rule != nil {
+		switch rule.ListType {
+		case ListAllow:
+			return Decision{Blocked: false, Reason: "Device is in whitelist", Mode: mode, Rule: rule}
+		case ListReadOnly:
+			return Decision{Blocked: false, ReadOnly: true, Reason: "Device is read-only", Mode: mode, Rule: rule}
+		}
+		return Decision{Blocked: true, Reason: "Device is in blacklist", Mode: mode, Rule: rule}
+	}
+
+	// 无序列号且没有规则放行时阻断 (高危规则)，明确放行的 vid:pid 不受影响
+	if BlockEmptySerial && (dev.Serial == "" || dev.Serial == "000000000000") {
+		return Decision{Blocked: true, Reason: "Unknown or empty serial number", Mode: mode}
+	}
+
+	// 未命中任何规则，按全局模式处理
+	if mode == ModeDefaultDeny {
+		return Decision{Blocked: true, Reason: "Device is not in whitelist", Mode: mode}
+	}
+	return Decision{Blocked: false, Mode: mode}
+}
+
+// vid/pid 是 4 位十六进制 (与 sysfs 中 idVendor/idProduct 一致)
+var hexIDPattern = regexp.MustCompile(`^[0-9a-fA-F]{4}$`)
+
+// Validate 校验并规范化规则 (空字段补 "*"，vid/pid 转小写，list_type 默认 deny)
+func (r *Rule) Validate() error {
+	r.Vid = orWildcard(strings.ToLower(r.Vid))
+	r.Pid = orWildcard(strings.ToLower(r.Pid))
+	r.Serial = orWildcard(r.Serial)
+	r.Product = orWildcard(r.Product)
+
+	if r.Vid != Wildcard && !hexIDPattern.MatchString(r.Vid) {
+		return fmt.Errorf("invalid vid %q: want 4 hex digits or *", r.Vid)
+	}
+	if r.Pid != Wildcard && !hexIDPattern.MatchString(r.Pid) {
+		return fmt.Errorf("invalid pid %q: want 4 hex digits or *", r.Pid)
+	}
+	if r.Vid == Wildcard && r.Pid != Wildcard {
+		return errors.New("pid requires a vid")
+	}
+	for _, p := range []string{r.Serial, r.Product} {
+		if _, err := path.Match(p, ""); err != nil {
+			return fmt.Errorf("bad pattern %q: %w", p, err)
+		}
+	}
+	if r.Vid == Wildcard && r.Serial == Wildcard && r.Product == Wildcard {
+		return errors.New("rule matches every device, use the global mode instead")
+	}
+	if r.ListType == "" {
+		r.ListType = ListDeny
+	}
+	if !ValidListType(r.ListType) {
+		return fmt.Errorf("invalid list type %q", r.ListType)
+	}
+	return nil
+}
+
+func orWildcard(s string) string {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return Wildcard
+	}
+	return s
+}
+
+// ValidListType 检查名单类型是否合法
+func ValidListType(listType string) bool {
+	return listType == ListAllow || listType == ListDeny || listType == ListReadOnly
+}
+
+// upsertRule 匹配字段相同 (vid, pid, serial, product) 的旧规则会被覆盖
+const upsertRule = `INSERT INTO blackwhitelist(vid,pid,serial,product,list_type,priority,reason,granted_by,expires_at) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
+	ON CONFLICT (vid, pid, serial, product) DO UPDATE SET
+		list_type = excluded.list_type, priority = excluded.priority, reason = excluded.reason,
+		granted_by = excluded.granted_by, expires_at = excluded.expires_at, created_at = CURRENT_TIMESTAMP`
+
+func upsertArgs(r Rule) []any {
+	return []any{r.Vid, r.Pid, r.Serial, r.Product, r.ListType, r.Priority, r.Reason, r.GrantedBy, dbTime(r.ExpiresAt)}
+}
+
+// AddRule 添加或覆盖一条规则
+func AddRule(r Rule) error {
+	if err := r.Validate(); err != nil {
+		return err
+	}
+	if BWdb == nil {
+		return errors.New("blackwhitelist database not initialized")
+	}
+	_, err := BWdb.Exec(upsertRule, upsertArgs(r)...)
+	return err
+}
+
+// RemoveRule 按匹配字段删除一条规则，规则不存在时返回 false
+func RemoveRule(r Rule) (bool, error) {
+	if err := r.Validate(); err != nil {
+		return false, err
 	}
+	return deleteRule("DELETE FROM blackwhitelist WHERE vid = ? AND pid = ? AND serial = ? AND product = ?",
+		r.Vid, r.Pid, r.Serial, r.Product)
+}
 
-	// 查数据库黑名单
-	var exists int
-	err := BWdb.QueryRow(
-		"SELECT 1 FROM blackwhitelist WHERE vid = ? AND pid = ? AND serial = ?",
-		vid, pid, serial,
-	).Scan(&exists)
+// RemoveRuleByID 按 id 删除一条规则，规则不存在时返回 false
+func RemoveRuleByID(id int64) (bool, error) {
+	return deleteRule("DELETE FROM blackwhitelist WHERE id = ?", id)
+}
 
-	if err == nil && exists == 1 {
-		return true, "Device is in blacklist"
+func deleteRule(query string, args ...any) (bool, error) {
+	if BWdb == nil {
+		return false, errors.New("blackwhitelist database not initialized")
+	}
+	res, err := BWdb.Exec(query, args...)
+	if err != nil {
+		return false, err
 	}
+	n, _ := res.RowsAffected()
+	return n > 0, nil
+}
 
-	// 默认放行
-	return false, ""
+// ListRules 列出全部规则，按生效顺序排列
+func ListRules() ([]Rule, error) {
+	if BWdb == nil {
+		return nil, errors.New("blackwhitelist database not initialized")
+	}
+	rows, err := BWdb.Query("SELECT " + ruleColumns + " FROM blackwhitelist ORDER BY priority DESC, id")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
 
+	var rules []Rule
+	for rows.Next() {
+		r, err := scanRule(rows)
+		if err != nil {
+			return nil, err
+		}
+		rules = append(rules, r)
+	}
+	return rules, rows.Err()
 }
 
-// AddBlockRule 添加黑名单工具函数
-func AddBlockRule(vid, pid, serial, reason string) {
-	if BWdb != nil {
-		BWdb.Exec(
-			"INSERT OR IGNORE INTO blackwhitelist(vid,pid,serial,reason)VALUES (?, ?, ?, ?)",
-			vid, pid, serial, reason,
-		)
+// ImportRules 在一个事务里批量写入规则，replace 为 true 时先清空旧规则
+// 任何一条校验失败都不会写入
+func ImportRules(rules []Rule, replace bool) error {
+	if BWdb == nil {
+		return errors.New("blackwhitelist database not initialized")
+	}
+	for i := range rules {
+		if err := rules[i].Validate(); err != nil {
+			return fmt.Errorf("rule %d: %w", i+1, err)
+		}
+	}
+
+	tx, err := BWdb.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if replace {
+		if _, err := tx.Exec("DELETE FROM blackwhitelist"); err != nil {
+			return err
+		}
+	}
+	for _, r := range rules {
+		if _, err := tx.Exec(upsertRule, upsertArgs(r)...); err != nil {
+			return err
+		}
 	}
+	return tx.Commit()
 }
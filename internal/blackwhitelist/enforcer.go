@@ -4,17 +4,36 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"regexp"
 )
 
+// busIDPattern USB 设备在 sysfs 中的名字，如 "1-1"、"2-1.4.3"
+var busIDPattern = regexp.MustCompile(`^[0-9]+-[0-9]+(\.[0-9]+)*$`)
+
 // BlockDevice 通过 Sysfs 禁用设备
 // busID 类似于 "1-1.2" (从 uevent 获取)
 func BlockDevice(busID string) error {
-	// 路径: /sys/bus/usb/devices/1-1.2/authorized
-	path := filepath.Join("/sys/bus/usb/devices", busID, "authorized")
 	// 写入 "0" 代表物理层级禁用
-	err := os.WriteFile(path, []byte("0"), 0644)
-	if err != nil {
+	if err := setAuthorized(busID, "0"); err != nil {
 		return fmt.Errorf("block failed: %v", err)
 	}
 	return nil
 }
+
+// UnblockDevice 重新授权被禁用的设备 (手动放行，不修改规则)
+func UnblockDevice(busID string) error {
+	if err := setAuthorized(busID, "1"); err != nil {
+		return fmt.Errorf("unblock failed: %v", err)
+	}
+	return nil
+}
+
+func setAuthorized(busID, value string) error {
+	// busID 可能来自 API 请求，防止拼出 sysfs 之外的路径
+	if !busIDPattern.MatchString(busID) {
+		return fmt.Errorf("invalid bus id %q", busID)
+	}
+	// 路径: /sys/bus/usb/devices/1-1.2/authorized
+	path := filepath.Join("/sys/bus/usb/devices", busID, "authorized")
+	return os.WriteFile(path, []byte(value), 0644)
+}
@@ -0,0 +1,114 @@
+package blackwhitelist
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/Hara602/usbSentry/internal/sysutil"
+	"go.uber.org/zap"
+)
+
+// ExemptionPriority 临时豁免的优先级，高于一般的厂商/型号封禁规则
+const ExemptionPriority = 1000
+
+// ExpireRules 删除所有已过期的规则并逐条记录日志，返回删除数量
+func ExpireRules() (int, error) {
+	if BWdb == nil {
+		return 0, errors.New("blackwhitelist database not initialized")
+	}
+	now := time.Now()
+	rows, err := BWdb.Query("SELECT "+ruleColumns+" FROM blackwhitelist WHERE expires_at IS NOT NULL AND expires_at <= ?", dbTime(&now))
+	if err != nil {
+		return 0, err
+	}
+	var expired []Rule
+	for rows.Next() {
+		r, err := scanRule(rows)
+		if err != nil {
+			rows.Close()
+			return 0, err
+		}
+		expired = append(expired, r)
+	}
+	rows.Close()
+
+	n := 0
+	for _, r := range expired {
+		if ok, err := RemoveRuleByID(r.ID); err != nil {
+			return n, err
+		} else if !ok {
+			continue
+		}
+		n++
+		sysutil.Log.Info("⌛ Rule expired",
+			zap.Int64("id", r.ID),
+			zap.String("list", r.ListType),
+			zap.String("vid", r.Vid),
+			zap.String("pid", r.Pid),
+			zap.String("serial", r.Serial),
+			zap.String("product", r.Product),
+			zap.String("granted_by", r.GrantedBy),
+			zap.Time("expires_at", *r.ExpiresAt),
+		)
+	}
+	return n, nil
+}
+
+// StartExpirer 启动后台任务，每隔 interval 清理一次过期规则，返回停止函数
+func StartExpirer(interval time.Duration) (stop func()) {
+	done := make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			if _, err := ExpireRules(); err != nil {
+				sysutil.Log.Error("expire rules failed", zap.Error(err))
+			}
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+	return func() { close(done) }
+}
+
+// GrantTemporary 临时放行一个具体设备 duration 时长，到期后规则自动删除
+// 已存在同一设备的永久规则时拒绝覆盖 (否则到期后原规则就丢了)；已有临时豁免则延长
+func GrantTemporary(vid, pid, serial string, duration time.Duration, grantedBy, reason string) (Rule, error) {
+	if duration <= 0 {
+		return Rule{}, errors.New("duration must be positive")
+	}
+	expires := time.Now().Add(duration)
+	r := Rule{
+		Vid:       vid,
+		Pid:       pid,
+		Serial:    serial,
+		ListType:  ListAllow,
+		Priority:  ExemptionPriority,
+		Reason:    reason,
+		GrantedBy: grantedBy,
+		ExpiresAt: &expires,
+	}
+	if err := r.Validate(); err != nil {
+		return r, err
+	}
+	if r.Vid == Wildcard || r.Pid == Wildcard || isGlob(r.Serial) {
+		return r, errors.New("temporary exemptions need an exact vid, pid and serial")
+	}
+	if BWdb == nil {
+		return r, errors.New("blackwhitelist database not initialized")
+	}
+
+	existing, err := scanRule(BWdb.QueryRow(
+		"SELECT "+ruleColumns+" FROM blackwhitelist WHERE vid = ? AND pid = ? AND serial = ? AND product = ?",
+		r.Vid, r.Pid, r.Serial, r.Product,
+	))
+	if err == nil && existing.ExpiresAt == nil {
+		return r, fmt.Errorf("device already has a permanent %s rule (id %d)", existing.ListType, existing.ID)
+	}
+
+	return r, AddRule(r)
+}
@@ -0,0 +1,121 @@
+package blackwhitelist
+
+import (
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/Hara602/usbSentry/internal/model"
+)
+
+// InventoryItem 历史设备清单中的一个设备
+type InventoryItem struct {
+	Vid          string    `json:"vid"`
+	Pid          string    `json:"pid"`
+	Serial       string    `json:"serial"`
+	Product      string    `json:"product"`
+	Manufacturer string    `json:"manufacturer"`
+	FirstSeen    time.Time `json:"first_seen"`
+	LastSeen     time.Time `json:"last_seen"`
+	InsertCount  int       `json:"insert_count"`
+	LastVerdict  string    `json:"last_verdict"` // ALLOW / DENY / READONLY / WOULD_DENY
+	LastReason   string    `json:"last_reason,omitempty"`
+}
+
+// Verdict 把裁决结果转换成清单中记录的 verdict，audit 为审计模式
+func (d Decision) Verdict(audit bool) string {
+	switch {
+	case d.Blocked && audit:
+		return model.VerdictWouldDeny
+	case d.Blocked:
+		return model.VerdictDeny
+	case d.ReadOnly:
+		return model.VerdictReadOnly
+	}
+	return model.VerdictAllow
+}
+
+// RecordDevice 更新设备清单：首次出现时新增，之后刷新 last_seen、产品信息和最近一次裁决
+// inserted 为 false 表示 Agent 启动时扫描到的已连接设备，不计入插入次数
+func RecordDevice(dev model.Device, verdict, reason string, inserted bool) error {
+	if BWdb == nil {
+		return errors.New("blackwhitelist database not initialized")
+	}
+	now := time.Now()
+	count := 0
+	if inserted {
+		count = 1
+	}
+	_, err := BWdb.Exec(`INSERT INTO device_inventory
+		(vid, pid, serial, product, manufacturer, first_seen, last_seen, insert_count, last_verdict, last_reason)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT (vid, pid, serial) DO UPDATE SET
+			product = excluded.product,
+			manufacturer = excluded.manufacturer,
+			last_seen = excluded.last_seen,
+			insert_count = insert_count + excluded.insert_count,
+			last_verdict = excluded.last_verdict,
+			last_reason = excluded.last_reason`,
+		strings.ToLower(dev.Vid), strings.ToLower(dev.Pid), dev.Serial, dev.Product, dev.Manufacturer,
+		dbTime(&now), dbTime(&now), count, verdict, reason,
+	)
+	return err
+}
+
+// InventoryFilter 清单查询条件，serial/product 支持 glob，空字段不过滤
+type InventoryFilter struct {
+	Vid     string
+	Pid     string
+	Serial  string
+	Product string
+	Since   time.Time // last_seen 不早于该时间
+}
+
+// ListInventory 按最近出现时间倒序列出设备
+func ListInventory(f InventoryFilter) ([]InventoryItem, error) {
+	if BWdb == nil {
+		return nil, errors.New("blackwhitelist database not initialized")
+	}
+	query := `SELECT vid, pid, serial, IFNULL(product, ''), IFNULL(manufacturer, ''), first_seen, last_seen,
+		insert_count, IFNULL(last_verdict, ''), IFNULL(last_reason, '') FROM device_inventory WHERE 1 = 1`
+	var args []any
+	if f.Vid != "" {
+		query += " AND vid = ?"
+		args = append(args, strings.ToLower(f.Vid))
+	}
+	if f.Pid != "" {
+		query += " AND pid = ?"
+		args = append(args, strings.ToLower(f.Pid))
+	}
+	if f.Serial != "" {
+		query += " AND serial GLOB ?"
+		args = append(args, f.Serial)
+	}
+	if f.Product != "" {
+		// 产品名匹配忽略大小写，与规则的 product glob 一致
+		query += " AND lower(product) GLOB ?"
+		args = append(args, strings.ToLower(f.Product))
+	}
+	if !f.Since.IsZero() {
+		query += " AND last_seen >= ?"
+		args = append(args, dbTime(&f.Since))
+	}
+	query += " ORDER BY last_seen DESC, vid, pid, serial"
+
+	rows, err := BWdb.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var items []InventoryItem
+	for rows.Next() {
+		var it InventoryItem
+		if err := rows.Scan(&it.Vid, &it.Pid, &it.Serial, &it.Product, &it.Manufacturer, &it.FirstSeen, &it.LastSeen,
+			&it.InsertCount, &it.LastVerdict, &it.LastReason); err != nil {
+			return nil, err
+		}
+		items = append(items, it)
+	}
+	return items, rows.Err()
+}
@@ -0,0 +1,120 @@
+package blackwhitelist
+
+import (
+	"path"
+	"strings"
+	"time"
+
+	"github.com/Hara602/usbSentry/internal/model"
+)
+
+// bestMatch 找出命中设备的最优规则，没有命中返回 nil
+func bestMatch(dev model.Device) (*Rule, error) {
+	if BWdb == nil {
+		return nil, nil
+	}
+	// vid/pid 在 SQL 里预筛，serial/product 的 glob 在内存里匹配
+	vid, pid := strings.ToLower(dev.Vid), strings.ToLower(dev.Pid)
+	now := time.Now()
+	// 过期但还没被清理的规则同样不生效
+	rows, err := BWdb.Query(
+		"SELECT "+ruleColumns+" FROM blackwhitelist WHERE vid IN (?, '*') AND pid IN (?, '*') AND (expires_at IS NULL OR expires_at > ?)",
+		vid, pid, dbTime(&now),
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var best *Rule
+	for rows.Next() {
+		r, err := scanRule(rows)
+		if err != nil {
+			return nil, err
+		}
+		if !r.Matches(dev) {
+			continue
+		}
+		if best == nil || r.beats(best) {
+			rule := r
+			best = &rule
+		}
+	}
+	return best, rows.Err()
+}
+
+// Matches 判断规则是否命中设备
+func (r *Rule) Matches(dev model.Device) bool {
+	if r.Vid != Wildcard && !strings.EqualFold(r.Vid, dev.Vid) {
+		return false
+	}
+	if r.Pid != Wildcard && !strings.EqualFold(r.Pid, dev.Pid) {
+		return false
+	}
+	if r.Serial != Wildcard {
+		if ok, _ := path.Match(r.Serial, dev.Serial); !ok {
+			return false
+		}
+	}
+	if r.Product != Wildcard {
+		if ok, _ := path.Match(strings.ToLower(r.Product), strings.ToLower(dev.Product)); !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// Specificity 规则的具体程度，越大越具体
+// 具体序列号 (8) > 序列号 glob (4) > pid (2) > 具体产品名 (2) > 产品名 glob (1) > vid (1)
+func (r *Rule) Specificity() int {
+	score := 0
+	if r.Vid != Wildcard {
+		score += 1
+	}
+	if r.Pid != Wildcard {
+		score += 2
+	}
+	switch {
+	case r.Serial == Wildcard:
+	case isGlob(r.Serial):
+		score += 4
+	default:
+		score += 8
+	}
+	switch {
+	case r.Product == Wildcard:
+	case isGlob(r.Product):
+		score += 1
+	default:
+		score += 2
+	}
+	return score
+}
+
+// beats 冲突裁决：priority > 具体程度 > 名单严格程度 > 更新的规则
+func (r *Rule) beats(other *Rule) bool {
+	if r.Priority != other.Priority {
+		return r.Priority > other.Priority
+	}
+	if a, b := r.Specificity(), other.Specificity(); a != b {
+		return a > b
+	}
+	if a, b := strictness(r.ListType), strictness(other.ListType); a != b {
+		return a > b
+	}
+	return r.ID > other.ID
+}
+
+func strictness(listType string) int {
+	switch listType {
+	case ListDeny:
+		return 2
+	case ListReadOnly:
+		return 1
+	}
+	return 0
+}
+
+func isGlob(s string) bool {
+	return strings.ContainsAny(s, `*?[\`)
+}
@@ -0,0 +1,167 @@
+package blackwhitelist
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/Hara602/usbSentry/internal/model"
+	"github.com/Hara602/usbSentry/internal/sysutil"
+	"go.uber.org/zap"
+)
+
+// openTestDB 在临时目录里建库，测试结束后还原全局状态
+func openTestDB(t *testing.T) {
+	t.Helper()
+	prevDB, prevLog := BWdb, sysutil.Log
+	if err := InitBlackWhiteDB(filepath.Join(t.TempDir(), "bw.db")); err != nil {
+		t.Fatal(err)
+	}
+	sysutil.Log = zap.NewNop()
+	t.Cleanup(func() {
+		BWdb.Close()
+		BWdb, sysutil.Log = prevDB, prevLog
+	})
+}
+
+func TestBestMatchPrecedence(t *testing.T) {
+	dev := model.Device{Vid: "0781", Pid: "5583", Serial: "AB1234", Product: "Cruzer Blade"}
+	past := time.Now().Add(-time.Hour)
+
+	tests := []struct {
+		name  string
+		rules []Rule // 按顺序添加，后添加的 id 更大
+		want  string // 胜出规则的 reason，空表示没有命中
+	}{
+		{
+			name: "priority beats specificity",
+			rules: []Rule{
+				{Vid: "0781", ListType: ListDeny, Priority: 10, Reason: "vendor"},
+				{Vid: "0781", Pid: "5583", Serial: "AB1234", ListType: ListAllow, Reason: "device"},
+			},
+			want: "vendor",
+		},
+		{
+			name: "specificity beats strictness",
+			rules: []Rule{
+				{Vid: "0781", ListType: ListDeny, Reason: "vendor"},
+				{Vid: "0781", Pid: "5583", Serial: "AB1234", ListType: ListAllow, Reason: "device"},
+			},
+			want: "device",
+		},
+		{
+			name: "exact serial beats serial glob",
+			rules: []Rule{
+				{Vid: "0781", Pid: "5583", Serial: "AB*", ListType: ListDeny, Reason: "glob"},
+				{Vid: "0781", Pid: "5583", Serial: "AB1234", ListType: ListAllow, Reason: "exact"},
+			},
+			want: "exact",
+		},
+		{
+			name: "strictness breaks specificity ties",
+			rules: []Rule{
+				{Vid: "0781", Pid: "5583", Serial: "A*", ListType: ListDeny, Reason: "deny"},
+				{Vid: "0781", Pid: "5583", Serial: "AB*", ListType: ListReadOnly, Reason: "readonly"},
+				{Vid: "0781", Pid: "5583", Serial: "AB1*", ListType: ListAllow, Reason: "allow"},
+			},
+			want: "deny",
+		},
+		{
+			name: "readonly is stricter than allow",
+			rules: []Rule{
+				{Vid: "0781", Pid: "5583", Serial: "AB*", ListType: ListReadOnly, Reason: "readonly"},
+				{Vid: "0781", Pid: "5583", Serial: "AB1*", ListType: ListAllow, Reason: "allow"},
+			},
+			want: "readonly",
+		},
+		{
+			name: "newer rule breaks full ties",
+			rules: []Rule{
+				{Vid: "0781", Pid: "5583", Serial: "A*", ListType: ListAllow, Reason: "older"},
+				{Vid: "0781", Pid: "5583", Serial: "AB*", ListType: ListAllow, Reason: "newer"},
+			},
+			want: "newer",
+		},
+		{
+			name: "expired rules are ignored",
+			rules: []Rule{
+				{Vid: "0781", ListType: ListAllow, Reason: "vendor"},
+				{Vid: "0781", Pid: "5583", Serial: "AB1234", ListType: ListDeny, Reason: "expired", ExpiresAt: &past},
+			},
+			want: "vendor",
+		},
+		{
+			name: "non-matching rules are ignored",
+			rules: []Rule{
+				{Vid: "0781", Pid: "5583", Serial: "ZZ*", ListType: ListDeny, Reason: "other serial"},
+				{Vid: "0781", Product: "ultra*", ListType: ListDeny, Reason: "other product"},
+			},
+			want: "",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			openTestDB(t)
+			for _, r := range tt.rules {
+				if err := AddRule(r); err != nil {
+					t.Fatalf("AddRule(%+v): %v", r, err)
+				}
+			}
+			got, err := bestMatch(dev)
+			if err != nil {
+				t.Fatal(err)
+			}
+			reason := ""
+			if got != nil {
+				reason = got.Reason
+			}
+			if reason != tt.want {
+				t.Errorf("best match = %q, want %q", reason, tt.want)
+			}
+		})
+	}
+}
+
+func TestIsBlockedFailsClosedOnLookupError(t *testing.T) {
+	openTestDB(t)
+	BWdb.Close()
+	d := IsBlocked(model.Device{Vid: "0781", Pid: "5583", Serial: "AB1234"})
+	if !d.Blocked {
+		t.Errorf("IsBlocked with a broken database = %+v, want blocked", d)
+	}
+}
+
+func TestIsBlockedEmptySerial(t *testing.T) {
+	prev := BlockEmptySerial
+	BlockEmptySerial = true
+	t.Cleanup(func() { BlockEmptySerial = prev })
+
+	tests := []struct {
+		name        string
+		rules       []Rule
+		serial      string
+		wantBlocked bool
+	}{
+		{"no rules", nil, "", true},
+		{"all-zero serial", nil, "000000000000", true},
+		{"vid:pid allow rule", []Rule{{Vid: "0781", Pid: "5583", ListType: ListAllow}}, "", false},
+		{"vid:pid readonly rule", []Rule{{Vid: "0781", Pid: "5583", ListType: ListReadOnly}}, "", false},
+		{"rule for another model", []Rule{{Vid: "0781", Pid: "5590", ListType: ListAllow}}, "", true},
+		{"serial present", nil, "AB1234", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			openTestDB(t)
+			for _, r := range tt.rules {
+				if err := AddRule(r); err != nil {
+					t.Fatal(err)
+				}
+			}
+			d := IsBlocked(model.Device{Vid: "0781", Pid: "5583", Serial: tt.serial})
+			if d.Blocked != tt.wantBlocked {
+				t.Errorf("IsBlocked = %+v, want blocked=%v", d, tt.wantBlocked)
+			}
+		})
+	}
+}
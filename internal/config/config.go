@@ -0,0 +1,310 @@
+package config
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// DefaultPath 默认配置文件位置，文件不存在时使用内置默认值
+const DefaultPath = "/etc/usbSentry/config.yaml"
+
+// 执行模式
+const (
+	ModeEnforce = "enforce" // 真正阻断设备、拒绝文件访问
+	ModeAudit   = "audit"   // 只记录本该阻断的操作 (verdict=WOULD_DENY)，全部放行
+)
+
+// 可启用的分析器
+const (
+	AnalyzerBadUSB   = "badusb"   // 存储 + HID 复合设备检测
+	AnalyzerFileType = "filetype" // 文件类型伪装检测
+)
+
+// Config Agent 的全部可配置项
+type Config struct {
+	DBPath     string           `yaml:"db_path"`     // 黑白名单数据库
+	PolicyPath string           `yaml:"policy_path"` // 文件访问策略 (JSON)
+	Log        LogConfig        `yaml:"log"`
+	Enforce    EnforceConfig    `yaml:"enforcement"`
+	Analyzers  []string         `yaml:"analyzers"`
+	Mount      MountConfig      `yaml:"mount"`
+	Quarantine QuarantineConfig `yaml:"quarantine"`
+	Events     EventsConfig     `yaml:"events"`
+	API        APIConfig        `yaml:"api"`
+	Metrics    MetricsConfig    `yaml:"metrics"`
+	Sinks      []SinkConfig     `yaml:"sinks"` // 事件输出，可同时配置多个
+}
+
+type APIConfig struct {
+	Socket       string `yaml:"socket"`        // 本地控制 API 的 unix socket，为空时不启用
+	Group        string `yaml:"group"`         // 允许访问 socket 的用户组，为空时只有 root 能访问
+	RecentEvents int    `yaml:"recent_events"` // API 保留的最近事件条数
+}
+
+type MetricsConfig struct {
+	Listen string `yaml:"listen"` // Prometheus 指标监听地址，如 127.0.0.1:9477，为空时不启用
+}
+
+type EventsConfig struct {
+	DBPath string `yaml:"db_path"` // 本地事件库 (SQLite)，为空时不保存事件
+}
+
+type LogConfig struct {
+	Level  string `yaml:"level"`  // debug / info / warn / error
+	Format string `yaml:"format"` // console (开发) / json (生产)
+	Output string `yaml:"output"` // stdout / stderr / 文件路径
+
+	// 日志文件切割，仅 output 为文件时生效
+	MaxSizeMB  int  `yaml:"max_size_mb"`  // 单个文件达到该大小后切割
+	MaxAgeDays int  `yaml:"max_age_days"` // 旧文件保留天数，0 = 不限
+	MaxBackups int  `yaml:"max_backups"`  // 旧文件保留个数，0 = 不限
+	Compress   bool `yaml:"compress"`     // 旧文件 gzip 压缩
+}
+
+type EnforceConfig struct {
+	Mode             string `yaml:"mode"`               // enforce / audit
+	DeviceMode       string `yaml:"device_mode"`        // default-allow / default-deny，为空时沿用数据库中的设置
+	BlockEmptySerial bool   `yaml:"block_empty_serial"` // 阻断空序列号或全 0 序列号的设备 (有规则明确放行时除外)
+}
+
+type MountConfig struct {
+	WaitTimeout  time.Duration `yaml:"wait_timeout"`  // 等待分区挂载的最长时间
+	PollInterval time.Duration `yaml:"poll_interval"` // 轮询 /proc/mounts 的间隔
+}
+
+type QuarantineConfig struct {
+	Dir            string `yaml:"dir"`
+	RemoveOriginal bool   `yaml:"remove_original"` // 隔离后是否删除 U 盘上的原文件
+}
+
+// 事件 sink 类型
+const (
+	SinkJSONL    = "jsonl"    // 追加写 JSON Lines 文件
+	SinkStdout   = "stdout"   // 每行一个 JSON 输出到标准输出
+	SinkWebhook  = "webhook"  // HTTP POST 到收集端
+	SinkUnixgram = "unixgram" // unix datagram socket，每个事件一个数据报
+)
+
+// 事件 sink 输出格式
+const (
+	FormatJSON = "json" // usbSentry 自己的事件结构
+	FormatECS  = "ecs"  // Elastic Common Schema
+	FormatCEF  = "cef"  // ArcSight Common Event Format
+	FormatLEEF = "leef" // QRadar Log Event Extended Format
+)
+
+type SinkConfig struct {
+	Type    string            `yaml:"type"`
+	Path    string            `yaml:"path,omitempty"`    // jsonl: 文件路径; unixgram: socket 路径
+	URL     string            `yaml:"url,omitempty"`     // webhook
+	Headers map[string]string `yaml:"headers,omitempty"` // webhook 附加的请求头 (如 Authorization)
+	Timeout time.Duration     `yaml:"timeout,omitempty"` // webhook 单次请求超时
+	Format  string            `yaml:"format,omitempty"`  // 事件格式: json (默认) / ecs / cef / leef
+
+	Buffer       int           `yaml:"buffer,omitempty"`        // 缓冲队列长度，满了丢弃新事件
+	MaxRetries   int           `yaml:"max_retries,omitempty"`   // 发送失败的重试次数
+	RetryBackoff time.Duration `yaml:"retry_backoff,omitempty"` // 首次重试间隔，之后每次翻倍
+}
+
+// Default 内置默认值 (与此前硬编码的行为一致)
+func Default() *Config {
+	return &Config{
+		DBPath:     "./internal/db/blacklist.db",
+		PolicyPath: "./internal/db/policy.json",
+		Log: LogConfig{
+			Level:  "debug",
+			Format: "console",
+			Output: "stdout",
+
+			MaxSizeMB:  100,
+			MaxAgeDays: 30,
+			MaxBackups: 10,
+			Compress:   true,
+		},
+		Enforce: EnforceConfig{
+			Mode:             ModeEnforce,
+			BlockEmptySerial: true,
+		},
+		Analyzers: []string{AnalyzerBadUSB, AnalyzerFileType},
+		Mount: MountConfig{
+			WaitTimeout:  3 * time.Second,
+			PollInterval: 100 * time.Millisecond,
+		},
+		Quarantine: QuarantineConfig{
+			Dir: "/var/lib/usbSentry/quarantine",
+		},
+		Events: EventsConfig{
+			DBPath: "./internal/db/events.db",
+		},
+		API: APIConfig{
+			Socket:       "/run/usbSentry/agent.sock",
+			RecentEvents: 1000,
+		},
+	}
+}
+
+// Load 读取配置文件，未出现的字段保留默认值
+// required 为 false 时文件不存在不算错误 (使用默认配置路径的情况)
+func Load(path string, required bool) (*Config, error) {
+	cfg := Default()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) && !required {
+			return cfg, nil
+		}
+		return nil, fmt.Errorf("read config failed: %w", err)
+	}
+
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	dec.KnownFields(true) // 拼错的字段名直接报错，而不是悄悄忽略
+	if err := dec.Decode(cfg); err != nil && !errors.Is(err, io.EOF) {
+		return nil, fmt.Errorf("parse config %s failed: %w", path, err)
+	}
+	return cfg, nil
+}
+
+// Validate 检查配置是否合法
+func (c *Config) Validate() error {
+	var errs []error
+	if c.DBPath == "" {
+		errs = append(errs, errors.New("db_path is empty"))
+	}
+	if !oneOf(c.Log.Level, "debug", "info", "warn", "error") {
+		errs = append(errs, fmt.Errorf("log.level %q: want debug, info, warn or error", c.Log.Level))
+	}
+	if !oneOf(c.Log.Format, "console", "json") {
+		errs = append(errs, fmt.Errorf("log.format %q: want console or json", c.Log.Format))
+	}
+	if c.Log.Output == "" {
+		errs = append(errs, errors.New("log.output is empty"))
+	}
+	if c.Log.MaxSizeMB <= 0 {
+		errs = append(errs, errors.New("log.max_size_mb must be positive"))
+	}
+	if c.Log.MaxAgeDays < 0 || c.Log.MaxBackups < 0 {
+		errs = append(errs, errors.New("log.max_age_days and log.max_backups must not be negative"))
+	}
+	if !oneOf(c.Enforce.Mode, ModeEnforce, ModeAudit) {
+		errs = append(errs, fmt.Errorf("enforcement.mode %q: want %s or %s", c.Enforce.Mode, ModeEnforce, ModeAudit))
+	}
+	if !oneOf(c.Enforce.DeviceMode, "", "default-allow", "default-deny") {
+		errs = append(errs, fmt.Errorf("enforcement.device_mode %q: want default-allow or default-deny", c.Enforce.DeviceMode))
+	}
+	for _, a := range c.Analyzers {
+		if !oneOf(a, AnalyzerBadUSB, AnalyzerFileType) {
+			errs = append(errs, fmt.Errorf("analyzers: unknown analyzer %q", a))
+		}
+	}
+	if c.Mount.WaitTimeout <= 0 {
+		errs = append(errs, errors.New("mount.wait_timeout must be positive"))
+	}
+	if c.Mount.PollInterval <= 0 || c.Mount.PollInterval > c.Mount.WaitTimeout {
+		errs = append(errs, errors.New("mount.poll_interval must be positive and not exceed wait_timeout"))
+	}
+	if c.Quarantine.Dir == "" {
+		errs = append(errs, errors.New("quarantine.dir is empty"))
+	}
+	if c.API.Socket != "" && !filepath.IsAbs(c.API.Socket) {
+		errs = append(errs, fmt.Errorf("api.socket %q must be an absolute path", c.API.Socket))
+	}
+	if c.API.RecentEvents <= 0 {
+		errs = append(errs, errors.New("api.recent_events must be positive"))
+	}
+	if c.Metrics.Listen != "" && !isLoopback(c.Metrics.Listen) {
+		errs = append(errs, fmt.Errorf("metrics.listen %q: want host:port on a loopback address", c.Metrics.Listen))
+	}
+	for i, sc := range c.Sinks {
+		if err := sc.Validate(); err != nil {
+			errs = append(errs, fmt.Errorf("sinks[%d]: %w", i, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Validate 检查单个 sink 配置
+func (s *SinkConfig) Validate() error {
+	switch s.Type {
+	case SinkJSONL, SinkUnixgram:
+		if s.Path == "" {
+			return fmt.Errorf("%s sink needs a path", s.Type)
+		}
+	case SinkWebhook:
+		u, err := url.Parse(s.URL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("webhook sink needs an http(s) url, got %q", s.URL)
+		}
+	case SinkStdout:
+	default:
+		return fmt.Errorf("unknown sink type %q: want %s, %s, %s or %s", s.Type, SinkJSONL, SinkStdout, SinkWebhook, SinkUnixgram)
+	}
+	if !oneOf(s.Format, "", FormatJSON, FormatECS, FormatCEF, FormatLEEF) {
+		return fmt.Errorf("unknown sink format %q: want %s, %s, %s or %s", s.Format, FormatJSON, FormatECS, FormatCEF, FormatLEEF)
+	}
+	if s.Buffer < 0 || s.MaxRetries < 0 || s.RetryBackoff < 0 || s.Timeout < 0 {
+		return errors.New("buffer, max_retries, retry_backoff and timeout must not be negative")
+	}
+	return nil
+}
+
+// Enabled 判断分析器是否启用
+func (c *Config) Enabled(analyzer string) bool {
+	return oneOf(analyzer, c.Analyzers...)
+}
+
+// Audit 是否为只审计不阻断模式
+func (c *Config) Audit() bool {
+	return c.Enforce.Mode == ModeAudit
+}
+
+// YAML 输出当前配置 (用于 --print-config)
+func (c *Config) YAML() string {
+	var buf bytes.Buffer
+	enc := yaml.NewEncoder(&buf)
+	enc.SetIndent(2)
+	enc.Encode(c)
+	enc.Close()
+	return buf.String()
+}
+
+// ParseList 解析逗号分隔的列表 (用于 -analyzers)
+func ParseList(s string) []string {
+	var out []string
+	for _, v := range strings.Split(s, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			out = append(out, v)
+		}
+	}
+	return out
+}
+
+func oneOf(s string, options ...string) bool {
+	for _, o := range options {
+		if s == o {
+			return true
+		}
+	}
+	return false
+}
+
+// isLoopback 指标接口不做认证，只允许监听本机
+func isLoopback(addr string) bool {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return false
+	}
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
@@ -0,0 +1,211 @@
+package eventstore
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/Hara602/usbSentry/internal/model"
+	"github.com/Hara602/usbSentry/internal/sqlitedb"
+)
+
+// Store 本地事件库，保存所有 USB 事件、文件事件和分析结果
+// Agent 通过 Writer 写入，不经过会丢事件的 Fanout 队列
+type Store struct {
+	db   *sql.DB
+	path string
+}
+
+// migrations 按顺序执行的表结构变更，版本号记录在 PRAGMA user_version 中
+var migrations = []string{
+	// v1: 常用过滤条件单独成列，完整事件以 JSON 保存在 data 列
+	`CREATE TABLE IF NOT EXISTS events (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		ts DATETIME NOT NULL,
+		type TEXT NOT NULL,
+		host TEXT,
+		vid TEXT,
+		pid TEXT,
+		serial TEXT,
+		process TEXT,
+		process_pid INTEGER,
+		path TEXT,
+		op TEXT,
+		verdict TEXT,
+		data TEXT NOT NULL
+	);
+	CREATE INDEX IF NOT EXISTS idx_events_ts ON events (ts);
+	CREATE INDEX IF NOT EXISTS idx_events_serial ON events (serial);
+	CREATE INDEX IF NOT EXISTS idx_events_process ON events (process);`,
+	// v2: 文件事件关联到设备，按插入会话查询
+	`ALTER TABLE events ADD COLUMN session_id TEXT;
+	CREATE INDEX IF NOT EXISTS idx_events_session ON events (session_id);`,
+}
+
+// Open 打开 (必要时创建) 事件库
+func Open(path string) (*Store, error) {
+	db, err := sqlitedb.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open event database: %w", err)
+	}
+	// 查询命令和 Agent 可能同时打开同一个库；WAL 模式记录在库文件里，设置一次即可
+	if _, err := db.Exec("PRAGMA journal_mode = WAL"); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to configure event database: %w", err)
+	}
+	if err := sqlitedb.Migrate(db, migrations); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to create event tables: %w", err)
+	}
+	return &Store{db: db, path: path}, nil
+}
+
+func (s *Store) Name() string { return "eventstore:" + s.path }
+
+func (s *Store) Close() error { return s.db.Close() }
+
+// Append 在一个事务里保存一批事件，要么全部写入，要么都不写
+func (s *Store) Append(events []model.Event) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	stmt, err := tx.Prepare(`INSERT INTO events (ts, type, host, vid, pid, serial, session_id, process, process_pid, path, op, verdict, data)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+	for _, ev := range events {
+		data, err := json.Marshal(ev)
+		if err != nil {
+			return err
+		}
+		c := columnsOf(ev)
+		if _, err := stmt.Exec(dbTime(ev.Time), ev.Type, ev.Host, c.vid, c.pid, c.serial, c.session, c.process, c.processPID, c.path, c.op, c.verdict, string(data)); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// columns 从事件中提取出来、用于过滤的列
+type columns struct {
+	vid, pid, serial string
+	session          string
+	process          string
+	processPID       int32
+	path, op         string
+	verdict          string
+}
+
+func columnsOf(ev model.Event) columns {
+	var c columns
+	if d := ev.Device(); d != nil {
+		c.vid, c.pid, c.serial, c.session = d.Vid, d.Pid, d.Serial, d.SessionID
+	}
+	switch {
+	case ev.USB != nil:
+		e := ev.USB
+		c.path, c.op = e.MountPoint, e.Action
+	case ev.File != nil:
+		e := ev.File
+		c.process, c.processPID = e.ProcName, e.PID
+		c.path, c.op, c.verdict = e.FilePath, e.Operation, e.Verdict
+	case ev.Analysis != nil:
+		e := ev.Analysis
+		c.process, c.processPID = e.ProcName, e.PID
+		c.path, c.op, c.verdict = e.FilePath, e.Analyzer, e.RiskLevel
+	case ev.Session != nil:
+		e := ev.Session
+		c.path, c.op = e.Device.MountPoint, e.EndReason
+	}
+	return c
+}
+
+// dbTime 统一保存为 UTC、定长的字符串，保证按字符串比较与按时间比较一致
+func dbTime(t time.Time) string {
+	return t.UTC().Format("2006-01-02T15:04:05.000000000Z")
+}
+
+// Filter 查询条件，零值字段不参与过滤
+type Filter struct {
+	Since   time.Time
+	Until   time.Time
+	Type    string // usb / file / analysis / session
+	Serial  string // 设备序列号 (精确匹配)
+	Session string // 插入会话 ID
+	Process string // 进程名 (精确匹配)
+	Path    string // 路径 glob，* 可以跨目录，如 /media/*/*.exe
+	Op      string // 操作，包含匹配 (CLOSE_WRITE 可以匹配 OPEN_PERM|CLOSE_WRITE)，忽略大小写
+	Limit   int    // 最多返回条数，0 不限
+}
+
+// Query 按时间顺序返回符合条件的事件
+func (s *Store) Query(f Filter) ([]model.Event, error) {
+	var where []string
+	var args []any
+	if !f.Since.IsZero() {
+		where, args = append(where, "ts >= ?"), append(args, dbTime(f.Since))
+	}
+	if !f.Until.IsZero() {
+		where, args = append(where, "ts < ?"), append(args, dbTime(f.Until))
+	}
+	if f.Type != "" {
+		where, args = append(where, "type = ?"), append(args, f.Type)
+	}
+	if f.Serial != "" {
+		where, args = append(where, "serial = ?"), append(args, f.Serial)
+	}
+	if f.Session != "" {
+		where, args = append(where, "session_id = ?"), append(args, f.Session)
+	}
+	if f.Process != "" {
+		where, args = append(where, "process = ?"), append(args, f.Process)
+	}
+	if f.Path != "" {
+		// 改名事件的原路径也算，查 secret.docx 时能找到它被改成了什么
+		where = append(where, "(path GLOB ? OR json_extract(data, '$.file.old_path') GLOB ?)")
+		args = append(args, f.Path, f.Path)
+	}
+	if f.Op != "" {
+		where, args = append(where, "instr(upper(op), upper(?)) > 0"), append(args, f.Op)
+	}
+
+	query := "SELECT data FROM events"
+	if len(where) > 0 {
+		query += " WHERE " + strings.Join(where, " AND ")
+	}
+	// 有 limit 时取最新的 N 条，再按时间正序输出
+	query += " ORDER BY ts DESC, id DESC"
+	if f.Limit > 0 {
+		query += fmt.Sprintf(" LIMIT %d", f.Limit)
+	}
+
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var events []model.Event
+	for rows.Next() {
+		var data string
+		if err := rows.Scan(&data); err != nil {
+			return nil, err
+		}
+		var ev model.Event
+		if err := json.Unmarshal([]byte(data), &ev); err != nil {
+			return nil, fmt.Errorf("corrupt event: %w", err)
+		}
+		events = append(events, ev)
+	}
+	// 查询结果是倒序的，翻转回时间正序
+	for i, j := 0, len(events)-1; i < j; i, j = i+1, j-1 {
+		events[i], events[j] = events[j], events[i]
+	}
+	return events, rows.Err()
+}
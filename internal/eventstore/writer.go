@@ -0,0 +1,92 @@
+package eventstore
+
+import (
+	"time"
+
+	"github.com/Hara602/usbSentry/internal/metrics"
+	"github.com/Hara602/usbSentry/internal/model"
+	"github.com/Hara602/usbSentry/internal/sysutil"
+	"go.uber.org/zap"
+)
+
+const (
+	writerBuffer     = 4096 // 队列长度，写满后 Record 阻塞
+	maxBatch         = 512  // 一个事务最多写入的事件数
+	maxWriteAttempts = 5    // 一批事件的最多尝试次数
+	writeBackoff     = 200 * time.Millisecond
+)
+
+// Writer 事件库的专用写入协程
+// 事件库是审计记录，队列满时 Record 阻塞等待而不是丢弃；每次把队列中积压的事件放在一个事务里写入
+type Writer struct {
+	store *Store
+	queue chan model.Event
+	done  chan struct{}
+}
+
+// NewWriter 启动写入协程，Close 时连同 store 一起关闭
+func NewWriter(store *Store) *Writer {
+	w := &Writer{store: store, queue: make(chan model.Event, writerBuffer), done: make(chan struct{})}
+	go w.run()
+	return w
+}
+
+// Record 把事件放进写入队列，队列满时等待
+func (w *Writer) Record(ev model.Event) {
+	w.queue <- ev
+}
+
+// Pending 队列中等待写入的事件数
+func (w *Writer) Pending() int { return len(w.queue) }
+
+func (w *Writer) run() {
+	defer close(w.done)
+	batch := make([]model.Event, 0, maxBatch)
+	for ev := range w.queue {
+		batch = append(batch[:0], ev)
+		// 把已经排队的事件一起带上
+	collect:
+		for len(batch) < maxBatch {
+			select {
+			case ev, ok := <-w.queue:
+				if !ok {
+					break collect
+				}
+				batch = append(batch, ev)
+			default:
+				break collect
+			}
+		}
+		w.write(batch)
+	}
+}
+
+// write 写入一批事件，失败 (如库被长时间锁住、磁盘满) 时退避重试，多次失败后丢弃并记录
+// 不能无限重试：队列写满后会一路阻塞到 fanotify 的读取协程，被拦截的进程都会挂起
+func (w *Writer) write(batch []model.Event) {
+	backoff := writeBackoff
+	for attempt := 1; ; attempt++ {
+		err := w.store.Append(batch)
+		if err == nil {
+			return
+		}
+		if attempt >= maxWriteAttempts {
+			sysutil.Log.Error("event store write failed, dropping events",
+				zap.String("path", w.store.path),
+				zap.Int("events", len(batch)),
+				zap.Error(err))
+			metrics.SinkDropped.WithLabelValues(w.store.Name()).Add(float64(len(batch)))
+			return
+		}
+		time.Sleep(backoff)
+		backoff *= 2
+	}
+}
+
+// Close 停止接收事件，等队列中的事件写完后关闭事件库
+// 调用 Close 之后不能再 Record
+func (w *Writer) Close() error {
+	close(w.queue)
+	<-w.done
+	return w.store.Close()
+}
@@ -0,0 +1,121 @@
+package metrics
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/Hara602/usbSentry/internal/sysutil"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"go.uber.org/zap"
+)
+
+const namespace = "usbsentry"
+
+// Registry 只包含 Agent 自己的指标 (外加 Go 运行时和进程指标)
+var Registry = prometheus.NewRegistry()
+
+var (
+	// DevicesBlocked 被阻断的 USB 设备数，source 为 policy (黑白名单裁决) 或 api (手动阻断)
+	DevicesBlocked = newCounterVec("devices_blocked_total", "USB devices de-authorized by the agent.", "source")
+
+	// FileEvents 文件事件数，按操作 (OPEN_PERM / CLOSE_WRITE / CREATE ...) 分类
+	FileEvents = newCounterVec("file_events_total", "File events read from fanotify, by operation.", "op")
+
+	// PermissionDecisions 权限事件的裁决结果 (ALLOW / DENY / WOULD_DENY)
+	PermissionDecisions = newCounterVec("permission_decisions_total", "Permission event verdicts.", "verdict")
+
+	// PermissionLatency 从读到权限事件到回复内核的耗时，期间访问文件的进程被挂起
+	PermissionLatency = prometheus.NewHistogram(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "permission_response_seconds",
+		Help:      "Time from reading a permission event to writing the response.",
+		Buckets:   []float64{.0001, .00025, .0005, .001, .0025, .005, .01, .025, .05, .1, .25, .5, 1},
+	})
+
+	// MasqueradeDetections 文件类型伪装检测命中数，按风险等级分类
+	MasqueradeDetections = newCounterVec("masquerade_detections_total", "Files whose content does not match their extension, by risk level.", "risk")
+
+	// FanotifyReadErrors fanotify fd 读取出错的次数 (EAGAIN 除外)
+	FanotifyReadErrors = newCounterVec("fanotify_read_errors_total", "Errors reading from a fanotify fd, by reader.", "role")
+
+	// EmptyReads 被唤醒后第一次读取就返回 EAGAIN 的次数 (空唤醒)
+	EmptyReads = newCounterVec("fanotify_eagain_total", "Wakeups that found nothing to read (EAGAIN) on a fanotify fd, by reader.", "role")
+
+	// SinkDropped 事件输出丢弃的事件数 (队列满或重试耗尽)
+	SinkDropped = newCounterVec("sink_dropped_events_total", "Events dropped by an output sink.", "sink")
+
+	// LastEvent 最近一次发布事件的时间，长时间不变说明 Agent 已经不再上报
+	LastEvent = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "last_event_timestamp_seconds",
+		Help:      "Unix time of the last event published to the sinks.",
+	})
+)
+
+func init() {
+	Registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		DevicesBlocked, FileEvents, PermissionDecisions, PermissionLatency,
+		MasqueradeDetections, FanotifyReadErrors, EmptyReads, SinkDropped, LastEvent,
+	)
+}
+
+func newCounterVec(name, help string, label string) *prometheus.CounterVec {
+	return prometheus.NewCounterVec(prometheus.CounterOpts{Namespace: namespace, Name: name, Help: help}, []string{label})
+}
+
+// DevicesConnected 注册当前已连接设备数，fn 在每次抓取时调用
+func DevicesConnected(fn func() int) {
+	Registry.MustRegister(prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "devices_connected",
+		Help:      "USB storage partitions currently connected.",
+	}, func() float64 { return float64(fn()) }))
+}
+
+// ChannelDepth 注册内部队列的积压长度，持续增长说明主循环处理不过来
+func ChannelDepth(name string, fn func() int) {
+	Registry.MustRegister(prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+		Namespace:   namespace,
+		Name:        "channel_depth",
+		Help:        "Events waiting in an internal queue.",
+		ConstLabels: prometheus.Labels{"channel": name},
+	}, func() float64 { return float64(fn()) }))
+}
+
+// Server 指标 HTTP 服务
+type Server struct {
+	srv *http.Server
+}
+
+// Listen 在 addr 上提供 /metrics (地址由 config 校验为本机回环地址)
+func Listen(addr string) (*Server, error) {
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("metrics listen on %s failed: %w", addr, err)
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle("GET /metrics", promhttp.HandlerFor(Registry, promhttp.HandlerOpts{}))
+	s := &Server{srv: &http.Server{Handler: mux, ReadHeaderTimeout: 5 * time.Second}}
+	go func() {
+		if err := s.srv.Serve(ln); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			sysutil.Log.Error("metrics server stopped", zap.Error(err))
+		}
+	}()
+	sysutil.Log.Info("📈 Metrics listening", zap.String("addr", ln.Addr().String()))
+	return s, nil
+}
+
+func (s *Server) Close() error {
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	return s.srv.Shutdown(ctx)
+}
@@ -4,21 +4,187 @@ import "time"
 
 // USBEvent 硬件插拔事件
 type USBEvent struct {
-	Action     string // "add", "remove"
-	DevicePath string // e.g., /dev/sdb1
-	MountPoint string // e.g., /media/usb
-	IdVendor   string
-	IdProduct  string
-	Product    string
-	Serial     string
-	DeviceType string // "udisk", "badusb_suspect"
-	TimeStamp  time.Time
+	Action     string    `json:"action"`            // "add", "remove"
+	DevicePath string    `json:"device_path"`       // e.g., /dev/sdb1
+	SysPath    string    `json:"syspath,omitempty"` // USB 设备的 sysfs 路径, e.g. /sys/devices/.../1-1
+	MountPoint string    `json:"mount_point"`       // e.g., /media/usb
+	IdVendor   string    `json:"vid"`
+	IdProduct  string    `json:"pid"`
+	Product    string    `json:"product"`
+	Serial     string    `json:"serial"`
+	DeviceType string    `json:"device_type"` // DeviceTypeUDisk、DeviceTypeBadUSB 等
+	ReadOnly   bool      `json:"read_only"`   // 黑白名单规则要求只读
+	SessionID  string    `json:"session_id"`  // 本次插入的会话 ID
+	TimeStamp  time.Time `json:"timestamp"`
 }
 
+// USBEvent.DeviceType 的取值 (由 analysis.CheckBadUSB 判定)
+const (
+	DeviceTypeUDisk   = "udisk"
+	DeviceTypeBadUSB  = "BADUSB_SUSPECT" // 存储设备同时带有 HID 接口
+	DeviceTypeOther   = "other"
+	DeviceTypeUnknown = "unknown"
+)
+
+// Device 返回事件对应的设备身份
+func (e USBEvent) Device() Device {
+	return Device{Vid: e.IdVendor, Pid: e.IdProduct, Serial: e.Serial, Product: e.Product, ReadOnly: e.ReadOnly}
+}
+
+// Context 返回事件对应的设备上下文
+func (e USBEvent) Context() DeviceContext {
+	return DeviceContext{Device: e.Device(), DevPath: e.DevicePath, MountPoint: e.MountPoint, SessionID: e.SessionID}
+}
+
+// Device USB 设备身份 (用于策略匹配)
+type Device struct {
+	Vid          string `json:"vid"`
+	Pid          string `json:"pid"`
+	Serial       string `json:"serial"`
+	Product      string `json:"product"`
+	Manufacturer string `json:"manufacturer,omitempty"`
+	ReadOnly     bool   `json:"read_only"` // 只读设备：拒绝以写方式打开文件
+}
+
+// DeviceContext 一次挂载对应的设备上下文，附在该挂载点产生的每个事件上
+type DeviceContext struct {
+	Device
+	DevPath    string `json:"devpath"` // 分区设备节点, e.g. /dev/sdb1
+	MountPoint string `json:"mount_point"`
+	SessionID  string `json:"session_id"` // 一次插入 (从挂载到拔出) 的唯一 ID
+}
+
+// 权限裁决结果
+const (
+	VerdictAllow     = "ALLOW"
+	VerdictDeny      = "DENY"
+	VerdictWouldDeny = "WOULD_DENY" // 审计模式下本该拒绝，实际放行
+	VerdictReadOnly  = "READONLY"   // 设备放行但只读
+)
+
+// FileEvent.PathSource 的取值，表示路径的可信度
+const (
+	PathFromFd     = "fd"         // Blocker 事件的 fd，精确
+	PathFromHandle = "handle"     // open_by_handle_at 还原父目录，精确
+	PathFromCache  = "cache"      // 目录缓存 (FAT 等不支持 handle 的文件系统)，目录之后被移走时可能过时
+	PathUnresolved = "unresolved" // 父目录未知，路径形如 <挂载点>/.../文件名
+)
+
 type FileEvent struct {
-	PID       int32  // 进程ID
-	ProcName  string // 进程名
-	FilePath  string
-	Operation string
-	TimeStamp time.Time
+	PID        int32          `json:"process_pid"` // 进程ID
+	ProcName   string         `json:"process"`     // 进程名
+	FilePath   string         `json:"path"`
+	OldPath    string         `json:"old_path,omitempty"`    // RENAME 的原路径，FilePath 为新路径
+	PathSource string         `json:"path_source,omitempty"` // 路径的来源，见 PathFrom*
+	Operation  string         `json:"op"`
+	Verdict    string         `json:"verdict,omitempty"` // 权限事件的裁决结果 (ALLOW/DENY/WOULD_DENY)，非权限事件为空
+	Reason     string         `json:"reason,omitempty"`  // 裁决依据 (命中的策略规则)
+	Size       int64          `json:"size,omitempty"`    // CLOSE_WRITE 时的文件大小
+	Device     *DeviceContext `json:"device,omitempty"`  // 文件所在的 U 盘，找不到对应挂载点时为 nil
+	Process    *ProcessInfo   `json:"process_info,omitempty"`
+	TimeStamp  time.Time      `json:"timestamp"`
+}
+
+// ProcessInfo 触发文件事件的进程详情，字段读不到时留空
+type ProcessInfo struct {
+	PID         int32        `json:"pid"`
+	PPID        int32        `json:"ppid,omitempty"`
+	Name        string       `json:"name"` // /proc/<pid>/comm
+	Exe         string       `json:"exe,omitempty"`
+	ExeSHA256   string       `json:"exe_sha256,omitempty"`
+	Cmdline     []string     `json:"cmdline,omitempty"`
+	UID         uint32       `json:"uid"`
+	User        string       `json:"user,omitempty"`
+	EUID        uint32       `json:"euid"`
+	EUser       string       `json:"euser,omitempty"`
+	LoginUID    *uint32      `json:"loginuid,omitempty"`      // 审计登录用户 (sudo 之后不变)，未设置时为空
+	LoginUser   string       `json:"login_user,omitempty"`    // LoginUID 对应的用户名
+	AuditSessID *uint32      `json:"audit_session,omitempty"` // 审计会话 ID，未设置时为空
+	TTY         string       `json:"tty,omitempty"`           // e.g. pts/0
+	Cgroup      string       `json:"cgroup,omitempty"`
+	ContainerID string       `json:"container_id,omitempty"` // 从 cgroup 路径中识别的容器 ID
+	StartTime   time.Time    `json:"start_time"`
+	Ancestors   []ProcessRef `json:"ancestors,omitempty"` // 父进程链，从父进程开始往上
+	Exited      bool         `json:"exited,omitempty"`    // 读取时进程已退出，只有 PID
+}
+
+// ProcessRef 祖先进程的简要信息
+type ProcessRef struct {
+	PID  int32  `json:"pid"`
+	Name string `json:"name"`
+	Exe  string `json:"exe,omitempty"`
+}
+
+// AnalysisEvent 分析器的检测结果 (BadUSB、文件类型伪装等)
+type AnalysisEvent struct {
+	Analyzer     string        `json:"analyzer"`             // "badusb", "filetype"
+	RiskLevel    string        `json:"risk_level,omitempty"` // 分析器给出的风险等级
+	Message      string        `json:"message"`
+	Device       DeviceContext `json:"device"`
+	FilePath     string        `json:"path,omitempty"`
+	PID          int32         `json:"process_pid,omitempty"`
+	ProcName     string        `json:"process,omitempty"`
+	RealExt      string        `json:"real_ext,omitempty"`      // filetype: 文件头识别出的真实类型
+	DeclaredExt  string        `json:"declared_ext,omitempty"`  // filetype: 文件名后缀
+	QuarantineID string        `json:"quarantine_id,omitempty"` // 已移入隔离区时的 ID
+	TimeStamp    time.Time     `json:"timestamp"`
+}
+
+// SessionSummary 一次插入 (从挂载到拔出) 的汇总报告
+type SessionSummary struct {
+	SessionID        string        `json:"session_id"`
+	Device           DeviceContext `json:"device"`
+	InsertedAt       time.Time     `json:"inserted_at"`
+	RemovedAt        time.Time     `json:"removed_at"`
+	DurationSeconds  float64       `json:"duration_seconds"`
+	EndReason        string        `json:"end_reason"` // "removed" 或 "agent_stopped"
+	FilesCreated     int           `json:"files_created"`
+	FilesWritten     int           `json:"files_written"` // 写入过的不同文件数
+	FilesDeleted     int           `json:"files_deleted"`
+	FilesRenamed     int           `json:"files_renamed"`
+	WrittenFilesSize int64         `json:"written_files_size"` // 写入过的文件最后一次写完时的大小之和 (不是写入的字节数：覆盖写、追加只算最终大小)
+	Denied           int           `json:"denied"`             // 被拒绝 (或审计模式下本该拒绝) 的访问次数
+	Processes        []ProcessStat `json:"processes"`
+}
+
+// ProcessStat 会话中某个进程名的操作统计
+type ProcessStat struct {
+	Name   string  `json:"name"`
+	PIDs   []int32 `json:"pids"`
+	Events int     `json:"events"`
+}
+
+// 事件类型
+const (
+	EventUSB      = "usb"
+	EventFile     = "file"
+	EventAnalysis = "analysis"
+	EventSession  = "session"
+)
+
+// Event 发往外部 sink 的统一事件信封，按 Type 只填其中一个载荷
+type Event struct {
+	Type     string          `json:"type"`
+	Time     time.Time       `json:"time"`
+	Host     string          `json:"host"`
+	USB      *USBEvent       `json:"usb,omitempty"`
+	File     *FileEvent      `json:"file,omitempty"`
+	Analysis *AnalysisEvent  `json:"analysis,omitempty"`
+	Session  *SessionSummary `json:"session,omitempty"`
+}
+
+// Device 事件关联的设备，没有时返回 nil
+func (e Event) Device() *DeviceContext {
+	switch {
+	case e.USB != nil:
+		dc := e.USB.Context()
+		return &dc
+	case e.File != nil:
+		return e.File.Device
+	case e.Analysis != nil:
+		return &e.Analysis.Device
+	case e.Session != nil:
+		return &e.Session.Device
+	}
+	return nil
 }
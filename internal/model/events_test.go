@@ -0,0 +1,34 @@
+package model
+
+import "testing"
+
+func TestEventDevice(t *testing.T) {
+	dev := DeviceContext{Device: Device{Vid: "0781", Pid: "5583", Serial: "AB1234"}, SessionID: "s1"}
+	tests := []struct {
+		name string
+		ev   Event
+		want string // 序列号，空表示没有设备
+	}{
+		{"usb", Event{USB: &USBEvent{IdVendor: "0781", IdProduct: "5583", Serial: "AB1234", SessionID: "s1"}}, "AB1234"},
+		{"file", Event{File: &FileEvent{Device: &dev}}, "AB1234"},
+		{"file without device", Event{File: &FileEvent{}}, ""},
+		{"analysis", Event{Analysis: &AnalysisEvent{Device: dev}}, "AB1234"},
+		{"session", Event{Session: &SessionSummary{Device: dev}}, "AB1234"},
+		{"empty", Event{}, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := tt.ev.Device()
+			serial := ""
+			if got != nil {
+				serial = got.Serial
+				if got.SessionID != "s1" {
+					t.Errorf("Device().SessionID = %q, want %q", got.SessionID, "s1")
+				}
+			}
+			if serial != tt.want {
+				t.Errorf("Device() serial = %q, want %q", serial, tt.want)
+			}
+		})
+	}
+}
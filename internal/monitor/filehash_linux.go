@@ -0,0 +1,102 @@
+//go:build linux
+
+package monitor
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"sync"
+
+	"golang.org/x/sys/unix"
+)
+
+// hashKey 用 inode + 大小 + 修改时间标识文件内容，内容变了 key 就变
+type hashKey struct {
+	dev   uint64
+	ino   uint64
+	size  int64
+	mtime int64
+}
+
+// hashCache 缓存可执行文件的 SHA-256，同一个程序反复执行时不用重复计算
+type hashCache struct {
+	mu      sync.Mutex
+	entries map[hashKey]string
+}
+
+const maxHashCacheEntries = 4096
+
+// 权限事件里按哈希放行时最多读这么多：期间打开文件的进程一直挂起，所有权限事件也都在排队
+// 更大的文件不算哈希，哈希例外不生效 (noexec 照常拦截)
+const maxPermHashSize = 64 << 20
+
+func newHashCache() *hashCache {
+	return &hashCache{entries: make(map[hashKey]string)}
+}
+
+// hashFd 通过 fanotify 给的 FD 计算文件 SHA-256 (用 pread，不改变文件偏移)，超过 maxSize 的文件不算
+func (c *hashCache) hashFd(fd int, maxSize int64) (string, error) {
+	var st unix.Stat_t
+	if err := unix.Fstat(fd, &st); err != nil {
+		return "", err
+	}
+	if st.Size > maxSize {
+		return "", fmt.Errorf("file too large to hash (%d bytes)", st.Size)
+	}
+	key := hashKey{dev: st.Dev, ino: st.Ino, size: st.Size, mtime: st.Mtim.Nano()}
+
+	c.mu.Lock()
+	if h, ok := c.entries[key]; ok {
+		c.mu.Unlock()
+		return h, nil
+	}
+	c.mu.Unlock()
+
+	hasher := sha256.New()
+	buf := make([]byte, 64*1024)
+	var off int64
+	for {
+		n, err := unix.Pread(fd, buf, off)
+		if err != nil {
+			return "", err
+		}
+		if n == 0 {
+			break
+		}
+		hasher.Write(buf[:n])
+		off += int64(n)
+	}
+	sum := hex.EncodeToString(hasher.Sum(nil))
+
+	c.mu.Lock()
+	// 简单粗暴的上限：满了就整体清空
+	if len(c.entries) >= maxHashCacheEntries {
+		c.entries = make(map[hashKey]string)
+	}
+	c.entries[key] = sum
+	c.mu.Unlock()
+	return sum, nil
+}
+
+// hashPath 打开文件计算 SHA-256，超过 maxSize 的文件不算
+func (c *hashCache) hashPath(path string, maxSize int64) (string, error) {
+	fd, err := unix.Open(path, unix.O_RDONLY|unix.O_CLOEXEC, 0)
+	if err != nil {
+		return "", err
+	}
+	defer unix.Close(fd)
+	sum, err := c.hashFd(fd, maxSize)
+	if err != nil {
+		return "", fmt.Errorf("%s: %v", path, err)
+	}
+	return sum, nil
+}
+
+// isELF 检查文件头是否为 ELF 魔数
+func isELF(fd int) bool {
+	var magic [4]byte
+	n, err := unix.Pread(fd, magic[:], 0)
+	return err == nil && n == 4 && bytes.Equal(magic[:], []byte{0x7f, 'E', 'L', 'F'})
+}
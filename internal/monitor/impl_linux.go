@@ -3,20 +3,22 @@
 package monitor
 
 import (
-	"bytes"
 	"encoding/binary"
 	"errors"
 	"fmt"
-	"io"
 	"os"
 	"path/filepath"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 	"unsafe"
 
 	"github.com/Hara602/usbSentry/internal/analysis"
+	"github.com/Hara602/usbSentry/internal/metrics"
 	"github.com/Hara602/usbSentry/internal/model"
+	"github.com/Hara602/usbSentry/internal/policy"
+	"github.com/Hara602/usbSentry/internal/quarantine"
 	"github.com/Hara602/usbSentry/internal/sysutil"
 	"golang.org/x/sys/unix"
 )
@@ -24,15 +26,36 @@ import (
 type fanotifyMonitor struct {
 	fdBlocker  int // 用于拦截和精准路径 (PRE_CONTENT)
 	fdRecorder int // 用于记录文件名 (NOTIF + DFID)
-	mountPath  string
+	mu         sync.RWMutex
+	fss        map[unix.Fsid]*watchedFS // 被监控的文件系统，见 mounts_linux.go
+	dirs       *dirCache                // Recorder 事件还原父目录用
+	renames    bool                     // 内核支持 FAN_RENAME (5.17+)，一次改名一个事件
+	moves      *movePairer              // 不支持 FAN_RENAME 时配对 MOVED_FROM / MOVED_TO
 	selfPid    int
+	policy     *policy.Engine
+	hashes     *hashCache
+	procs      *procCache // 进程详情，按 PID + 启动时间缓存
+	vault      *quarantine.Store
+	removeOrig bool
+	fileType   bool
+	audit      bool
 	events     chan model.FileEvent
+	findings   chan model.AnalysisEvent
+	wake       int            // eventfd，Stop 时写入以唤醒 readLoop
+	loops      sync.WaitGroup // 两个 readLoop
 	stop       chan struct{}
 }
 
 var typeInspector = analysis.NewTypeInspector()
 
-func newMonitor() (FileMonitor, error) {
+// 需要回复的权限事件。x/sys 的 FAN_ALL_PERM_EVENTS 只有 OPEN_PERM 和 ACCESS_PERM，
+// 漏掉 OPEN_EXEC_PERM 会导致执行 U 盘上的程序时进程一直挂起
+const permEvents = unix.FAN_ALL_PERM_EVENTS | unix.FAN_OPEN_EXEC_PERM
+
+// 改名事件的操作名 (FAN_RENAME，或配对后的 MOVED_FROM + MOVED_TO)
+const opRename = "RENAME"
+
+func newMonitor(cfg Config) (FileMonitor, error) {
 	// 1. 初始化 Blocker (保镖): 负责拦截、执行检查、文件写入完成检查
 	// 使用 PRE_CONTENT，内核会直接给 FD
 	flagsBlocker := uint(unix.FAN_CLASS_PRE_CONTENT |
@@ -48,131 +71,81 @@ func newMonitor() (FileMonitor, error) {
 
 	// 2. 初始化 Recorder (记者): 负责记录创建和删除
 	// 使用 REPORT_DFID_NAME，可以拿到 CREATE/DELETE 的文件名
+	// 新内核再加上 REPORT_TARGET_FID (同时上报对象本身的 handle)，并监听 FAN_RENAME
 	flagsRecorder := uint(unix.FAN_CLASS_NOTIF |
 		unix.FAN_REPORT_DFID_NAME |
 		unix.FAN_CLOEXEC |
 		unix.FAN_UNLIMITED_QUEUE |
-		unix.FAN_UNLIMITED_MARKS)
+		unix.FAN_UNLIMITED_MARKS |
+		unix.FAN_NONBLOCK)
 
-	fdRecorder, err := unix.FanotifyInit(flagsRecorder, unix.O_RDONLY)
+	renames := true
+	fdRecorder, err := unix.FanotifyInit(flagsRecorder|unix.FAN_REPORT_FID|unix.FAN_REPORT_TARGET_FID, unix.O_RDONLY)
+	if errors.Is(err, unix.EINVAL) {
+		// 老内核 (< 5.17) 不认识 TARGET_FID，降级为 MOVED_FROM / MOVED_TO 配对
+		renames = false
+		fdRecorder, err = unix.FanotifyInit(flagsRecorder, unix.O_RDONLY)
+	}
 	if err != nil {
 		unix.Close(fdBlocker) // 失败要回滚
 		return nil, fmt.Errorf("fanotify init recorder failed: %v", err)
 	}
 
-	return &fanotifyMonitor{
+	wake, err := unix.Eventfd(0, unix.EFD_CLOEXEC|unix.EFD_NONBLOCK)
+	if err != nil {
+		unix.Close(fdBlocker)
+		unix.Close(fdRecorder)
+		return nil, fmt.Errorf("eventfd failed: %v", err)
+	}
+
+	engine := cfg.Policy
+	if engine == nil {
+		engine = policy.NewEngine()
+	}
+
+	hashes := newHashCache()
+	f := &fanotifyMonitor{
 		fdBlocker:  fdBlocker,
 		fdRecorder: fdRecorder,
-		mountPath:  "",
+		fss:        make(map[unix.Fsid]*watchedFS),
+		dirs:       newDirCache(),
+		renames:    renames,
 		selfPid:    os.Getpid(),
+		policy:     engine,
+		hashes:     hashes,
+		vault:      cfg.Quarantine,
+		removeOrig: cfg.RemoveOriginal,
+		fileType:   cfg.FileType,
+		audit:      cfg.Audit,
 		events:     make(chan model.FileEvent, 100),
+		findings:   make(chan model.AnalysisEvent, 100),
+		wake:       wake,
 		stop:       make(chan struct{}),
-	}, nil
-}
-
-func (f *fanotifyMonitor) Start() {
-	// 启动两个协程，分别监听两个 FD
-	go f.readLoop(f.fdBlocker, "Blocker")
-	go f.readLoop(f.fdRecorder, "Recorder")
-}
-
-// 通用的读取循环
-func (f *fanotifyMonitor) readLoop(fd int, role string) {
-	var buf [4096]byte
-	for {
-		select {
-		case <-f.stop:
-			return
-		default:
-			n, err := unix.Read(fd, buf[:])
-
-			// 处理非阻塞读取的 EAGAIN 错误
-			if err == unix.EAGAIN {
-				time.Sleep(2 * time.Millisecond)
-				continue
-			}
-
-			if err != nil {
-				if errors.Is(err, unix.EBADF) || errors.Is(err, unix.EINTR) {
-					return
-				}
-				// 其他错误简单记录后继续
-				continue
-			}
-
-			// 遍历 Buffer 处理所有事件
-			offset := 0
-			for offset < n {
-				if offset+model.FanotifyEventMetadataSize > n {
-					break
-				}
-
-				reader := bytes.NewReader(buf[offset : offset+model.FanotifyEventMetadataSize])
-				var metadata unix.FanotifyEventMetadata
-				if err := binary.Read(reader, binary.LittleEndian, &metadata); err != nil {
-					sysutil.LogSugar.Error("fanotify metadata read failed: %v", err)
-					break
-				}
-
-				// 检查完整性
-				if metadata.Event_len < uint32(model.FanotifyEventMetadataSize) || offset+int(metadata.Event_len) > n {
-					break
-				}
-
-				// 处理单个事件 (传递 fd 用于回写响应)
-				f.processOneEvent(fd, role, buf[offset:offset+int(metadata.Event_len)], metadata)
-
-				offset += int(metadata.Event_len)
-			}
-		}
 	}
+	f.procs = newProcCache(hashes, f.watching, f.stop)
+	f.moves = newMovePairer(f.send)
+	return f, nil
 }
 
-func (f *fanotifyMonitor) AddWatch(mountPath string) error {
-	f.mountPath = mountPath
-
-	// 1. Blocker 监听：权限拦截 + 写入完成
-	// 这些事件都有 FD，路径精准
-	maskBlocker := uint64(unix.FAN_CLOSE_WRITE |
-		unix.FAN_OPEN_PERM | // 拦截打开
-		unix.FAN_OPEN_EXEC_PERM | // 拦截执行
-		unix.FAN_EVENT_ON_CHILD)
-
-	err := unix.FanotifyMark(f.fdBlocker, unix.FAN_MARK_ADD|unix.FAN_MARK_FILESYSTEM, maskBlocker, unix.AT_FDCWD, mountPath)
-	if err != nil {
-		return fmt.Errorf("blocker mark failed: %v", err)
+// recorderMask Recorder 监听：创建、删除、改名/移动
+func (f *fanotifyMonitor) recorderMask() uint64 {
+	mask := uint64(unix.FAN_CREATE | unix.FAN_DELETE | unix.FAN_ONDIR | unix.FAN_EVENT_ON_CHILD)
+	if f.renames {
+		return mask | unix.FAN_RENAME
 	}
-
-	// 2. Recorder 监听：创建、删除、移动
-	// 这些事件没有 FD，但有文件名
-	maskRecorder := uint64(unix.FAN_CREATE |
-		unix.FAN_DELETE |
-		unix.FAN_MOVED_TO |
-		unix.FAN_MOVED_FROM |
-		unix.FAN_ONDIR |
-		unix.FAN_EVENT_ON_CHILD)
-
-	err = unix.FanotifyMark(f.fdRecorder, unix.FAN_MARK_ADD|unix.FAN_MARK_FILESYSTEM, maskRecorder, unix.AT_FDCWD, mountPath)
-	if err != nil {
-		fmt.Println("⚠️  Warning: Recorder MARK_FILESYSTEM failed, trying directory only mode...")
-		// 尝试降级
-		err = unix.FanotifyMark(f.fdRecorder, unix.FAN_MARK_ADD, maskRecorder, unix.AT_FDCWD, mountPath)
-	}
-
-	return err
+	return mask | unix.FAN_MOVED_FROM | unix.FAN_MOVED_TO
 }
 
-func (f *fanotifyMonitor) RemoveWatch(mountPath string) {
-	// 两个都要移除
-	maskBlocker := uint64(unix.FAN_CLOSE_WRITE | unix.FAN_OPEN_PERM | unix.FAN_OPEN_EXEC_PERM | unix.FAN_EVENT_ON_CHILD)
-	_ = unix.FanotifyMark(f.fdBlocker, unix.FAN_MARK_REMOVE|unix.FAN_MARK_MOUNT, maskBlocker, unix.AT_FDCWD, mountPath)
-
-	maskRecorder := uint64(unix.FAN_CREATE | unix.FAN_DELETE | unix.FAN_MOVED_TO | unix.FAN_MOVED_FROM | unix.FAN_ONDIR | unix.FAN_EVENT_ON_CHILD)
-	_ = unix.FanotifyMark(f.fdRecorder, unix.FAN_MARK_REMOVE|unix.FAN_MARK_MOUNT, maskRecorder, unix.AT_FDCWD, mountPath)
+func (f *fanotifyMonitor) Start() {
+	// 启动两个协程，分别监听两个 FD
+	f.loops.Add(2)
+	go f.readLoop(f.fdBlocker, "Blocker")
+	go f.readLoop(f.fdRecorder, "Recorder")
 }
 
 // processOneEvent 处理单个事件
-func (f *fanotifyMonitor) processOneEvent(fd int, role string, eventBuf []byte, metadata unix.FanotifyEventMetadata) {
+// readAt 为读到事件的时间，用于统计权限事件的回复耗时
+func (f *fanotifyMonitor) processOneEvent(fd int, role string, eventBuf []byte, metadata unix.FanotifyEventMetadata, readAt time.Time) {
 	// 检查版本
 	if metadata.Vers != unix.FANOTIFY_METADATA_VERSION {
 		return
@@ -186,7 +159,7 @@ func (f *fanotifyMonitor) processOneEvent(fd int, role string, eventBuf []byte,
 
 	// 防死锁逻辑：如果是自己触发的事件，直接放行
 	if int(metadata.Pid) == f.selfPid {
-		if metadata.Mask&unix.FAN_ALL_PERM_EVENTS != 0 {
+		if metadata.Mask&permEvents != 0 {
 			// 必须回复 Allow，否则自己的 os.Open 会卡死
 			f.replyAllow(fd, metadata.Fd)
 		}
@@ -195,9 +168,14 @@ func (f *fanotifyMonitor) processOneEvent(fd int, role string, eventBuf []byte,
 
 	// 获取进程信息
 	pid := int32(metadata.Pid)
-	procName := getProcName(int(pid))
+	proc := f.procs.get(pid)
+	procName := proc.Name
+	if proc.Exited {
+		procName = "(exited)"
+	}
 	eventOp := getEventOp(metadata.Mask)
-	filePath := ""
+	filePath, pathSource, oldPath := "", "", ""
+	var mount *watchedMount
 
 	// 2. 路径获取逻辑 (双轨制)
 
@@ -207,132 +185,232 @@ func (f *fanotifyMonitor) processOneEvent(fd int, role string, eventBuf []byte,
 		if metadata.Fd >= 0 {
 			linkPath := fmt.Sprintf("/proc/self/fd/%d", metadata.Fd)
 			if path, err := os.Readlink(linkPath); err == nil {
-				filePath = path
+				filePath, pathSource = path, model.PathFromFd
+			}
+			// 按 fd 所在文件系统的 fsid 找挂载点，与 Recorder 的路由方式一致
+			var st unix.Statfs_t
+			if unix.Fstatfs(int(metadata.Fd), &st) == nil {
+				mount = f.mountFor(st.Fsid, filePath)
+			}
+			// 顺便记下父目录，供 Recorder 还原同目录下的 CREATE/DELETE
+			if mount != nil && filePath != "" {
+				f.dirs.learn(filepath.Dir(filePath), mount.fsid, false)
 			}
 		}
 	} else {
-		// [Recorder]：从 Buffer 解析文件名
+		// [Recorder]：从 Buffer 解析父目录 handle 和文件名
 		// 优势：能拿到 DELETE 的文件名
-		// 劣势：FAT32 上拿不到父目录，只能拼接到 U 盘根目录 (但这做日志足够了)
-		filePath = f.parseFileNameFromBuffer(eventBuf)
-		if filePath != "" {
-			// 简单降级：拼接到挂载点根目录
-			filePath = filepath.Join(f.mountPath, "...", filePath)
+		// 父目录优先查目录缓存，其次 open_by_handle_at，都失败时只能拼接到 U 盘根目录
+		fids := parseFids(eventBuf)
+		target, ok := fids[unix.FAN_EVENT_INFO_TYPE_DFID_NAME]
+		if metadata.Mask&unix.FAN_RENAME != 0 {
+			// FAN_RENAME 同时带有原位置和新位置
+			if from, ok := fids[unix.FAN_EVENT_INFO_TYPE_OLD_DFID_NAME]; ok {
+				oldPath, _ = f.resolvePath(from)
+			}
+			target, ok = fids[unix.FAN_EVENT_INFO_TYPE_NEW_DFID_NAME]
+		}
+		if ok {
+			filePath, pathSource = f.resolvePath(target)
+			mount = f.mountFor(target.fsid, filePath)
+			// 新建或移入的目录记下来，之后其中的文件也能还原
+			if metadata.Mask&unix.FAN_ONDIR != 0 && metadata.Mask&(unix.FAN_CREATE|unix.FAN_MOVED_TO|unix.FAN_RENAME) != 0 &&
+				pathSource != model.PathUnresolved {
+				if self, ok := fids[unix.FAN_EVENT_INFO_TYPE_FID]; ok {
+					// TARGET_FID 直接给出了目录自己的 handle，不用再 name_to_handle_at
+					f.dirs.put(self.key(), filePath)
+				} else {
+					f.dirs.learn(filePath, target.fsid, true)
+				}
+			}
 		}
 	}
 
 	// 如果没拿到路径，且不需要裁决，就提前结束
-	if filePath == "" && (metadata.Mask&unix.FAN_ALL_PERM_EVENTS == 0) {
+	if filePath == "" && (metadata.Mask&permEvents == 0) {
 		return
 	}
 
 	// 3. 业务逻辑
+	var devCtx *model.DeviceContext
+	var device model.Device
+	if mount != nil {
+		devCtx, device = mount.dev, mount.dev.Device
+	}
 
 	// A. 伪装文件检测 (仅 Blocker 的 CLOSE_WRITE 有效)
-	if strings.Contains(eventOp, "CLOSE_WRITE") && filePath != "" {
+	if f.fileType && strings.Contains(eventOp, "CLOSE_WRITE") && filePath != "" {
 		// 异步执行扫描！
 		// 必须放到 go func 里，否则 Inspect 耗时会导致主循环无法读取下一个事件
 		// 进而导致队列堆积，最终卡死系统
-		go func(path string, pName string, pID int32) {
+		go func(path string, pName string, pID int32, dev *model.DeviceContext) {
 			result, err := typeInspector.Inspect(path)
 			if err != nil {
 				return
 			}
 			if result.IsMasquerade {
 				sysutil.LogSugar.Warnf("🚨 Masquerade detected! [%s] %s", result.RiskLevel, path)
-				// 隔离逻辑...
+				metrics.MasqueradeDetections.WithLabelValues(result.RiskLevel).Inc()
+				finding := model.AnalysisEvent{
+					Analyzer:    "filetype",
+					RiskLevel:   result.RiskLevel,
+					Message:     result.Message,
+					FilePath:    path,
+					PID:         pID,
+					ProcName:    pName,
+					RealExt:     result.RealExt,
+					DeclaredExt: result.DeclaredExt,
+					TimeStamp:   time.Now(),
+				}
+				if dev != nil {
+					finding.Device = *dev
+				}
+				finding.QuarantineID = f.quarantine(path, pName, pID, finding.Device.Device, result)
+				select {
+				case f.findings <- finding:
+				case <-f.stop:
+				}
 			} else {
 				sysutil.LogSugar.Infof("✅ Safe file: %s (Type: %s)", path, result.RealExt)
 			}
-		}(filePath, procName, pid)
+		}(filePath, procName, pid, devCtx)
 	}
 
 	// B. 权限裁决 (拦截逻辑)
-	if metadata.Mask&unix.FAN_ALL_PERM_EVENTS != 0 {
-		// 默认放行
-		f.replyAllow(fd, metadata.Fd)
+	verdict, reason := "", ""
+	if metadata.Mask&permEvents != 0 {
+		op := policy.OpOpen
+		if metadata.Mask&unix.FAN_OPEN_EXEC_PERM != 0 {
+			op = policy.OpExec
+		} else if f.policy.NeedsWriteIntent(device) {
+			// 判断不出意图时，只读设备按写处理 (fail closed)
+			if write, ok := openForWrite(int(pid)); write || (!ok && device.ReadOnly) {
+				op = policy.OpWrite
+			}
+		}
+		eventFd := int(metadata.Fd)
+		decision := f.policy.Decide(policy.Request{
+			Op:       op,
+			Path:     filePath,
+			PID:      pid,
+			ProcName: procName,
+			Exe:      proc.Exe,
+			Device:   device,
+			Hash:     func() (string, error) { return f.hashes.hashFd(eventFd, maxPermHashSize) },
+			IsELF:    func() bool { return isELF(eventFd) },
+		})
+		verdict, reason = decision.Verdict, decision.Reason
+		if decision.Verdict == model.VerdictDeny && f.audit {
+			verdict = model.VerdictWouldDeny
+		}
+		if verdict == model.VerdictDeny {
+			f.replyDeny(fd, metadata.Fd)
+		} else {
+			f.replyAllow(fd, metadata.Fd)
+		}
+		metrics.PermissionLatency.Observe(time.Since(readAt).Seconds())
+		metrics.PermissionDecisions.WithLabelValues(verdict).Inc()
 	}
 
-	// 4. 发送事件到 Channel
-	f.events <- model.FileEvent{
-		PID:       pid,
-		ProcName:  procName,
-		FilePath:  filePath,
-		Operation: eventOp,
-		TimeStamp: time.Now(),
+	// 写入完成时记录文件大小 (会话统计写入量用)
+	var size int64
+	if metadata.Mask&unix.FAN_CLOSE_WRITE != 0 && metadata.Fd >= 0 {
+		var st unix.Stat_t
+		if unix.Fstat(int(metadata.Fd), &st) == nil {
+			size = st.Size
+		}
 	}
-}
 
-// 解析 Buffer 中的文件名 (用于 CREATE/DELETE 等没有 FD 的事件)
-func (f *fanotifyMonitor) parseFileNameFromBuffer(buf []byte) string {
-	reader := bytes.NewReader(buf)
-	// 跳过 Metadata
-	if _, err := reader.Seek(int64(model.FanotifyEventMetadataSize), io.SeekStart); err != nil {
-		return ""
+	ev := model.FileEvent{
+		PID:        pid,
+		ProcName:   procName,
+		FilePath:   filePath,
+		OldPath:    oldPath,
+		PathSource: pathSource,
+		Operation:  eventOp,
+		Verdict:    verdict,
+		Reason:     reason,
+		Size:       size,
+		Device:     devCtx,
+		Process:    proc,
+		TimeStamp:  time.Now(),
 	}
 
-	for {
-		var infoFid model.FanotifyEventInfoFid
-		if err := binary.Read(reader, binary.LittleEndian, &infoFid); err != nil {
-			break
-		}
+	// 老内核上把 MOVED_FROM + MOVED_TO 合并成一个 RENAME
+	switch {
+	case metadata.Mask&unix.FAN_MOVED_FROM != 0:
+		f.moves.from(ev)
+		return
+	case metadata.Mask&unix.FAN_MOVED_TO != 0:
+		ev = f.moves.to(ev)
+	}
 
-		if infoFid.Hdr.InfoType == unix.FAN_EVENT_INFO_TYPE_DFID_NAME {
-			var fileHandle model.FileHandle
-			if err := binary.Read(reader, binary.LittleEndian, &fileHandle); err != nil {
-				break
-			}
+	// 目录改名后，缓存中它下面的子目录也要改成新路径
+	if ev.Operation == opRename && metadata.Mask&unix.FAN_ONDIR != 0 && ev.OldPath != "" {
+		f.dirs.move(ev.OldPath, ev.FilePath)
+	}
 
-			// 跳过 Handle 数据 (FAT32上我们不需要去解析它，因为解析会失败)
-			if _, err := io.ReadFull(reader, make([]byte, fileHandle.HandleBytes)); err != nil {
-				break
-			}
+	// 4. 发送事件到 Channel
+	f.send(ev)
+}
 
-			// 计算文件名长度
-			headerSize := binary.Size(infoFid) + binary.Size(fileHandle)
-			nameLen := int(infoFid.Hdr.Len) - headerSize - int(fileHandle.HandleBytes)
-
-			if nameLen > 0 {
-				nameBuf := make([]byte, nameLen)
-				if _, err := io.ReadFull(reader, nameBuf); err == nil {
-					// 去掉结尾的 null 字符
-					if idx := bytes.IndexByte(nameBuf, 0); idx != -1 {
-						return string(nameBuf[:idx])
-					}
-					return string(nameBuf)
-				}
-			}
-		} else {
-			// 跳过非 DFID_NAME 信息
-			pad := int(infoFid.Hdr.Len) - binary.Size(infoFid)
-			if pad > 0 {
-				reader.Seek(int64(pad), io.SeekCurrent)
-			}
-		}
+func (f *fanotifyMonitor) send(ev model.FileEvent) {
+	metrics.FileEvents.WithLabelValues(ev.Operation).Inc()
+	select {
+	case f.events <- ev:
+	case <-f.stop:
 	}
-	return ""
 }
 
-func getProcName(pid int) string {
-	path := filepath.Join("/proc", strconv.Itoa(pid), "comm")
-	b, err := os.ReadFile(path)
+// quarantine 把伪装文件移入隔离区，返回隔离区 ID (未隔离时为空)
+func (f *fanotifyMonitor) quarantine(path, procName string, pid int32, dev model.Device, result *analysis.Result) string {
+	if f.vault == nil {
+		return ""
+	}
+	item, err := f.vault.Add(path, quarantine.Item{
+		Device:      dev,
+		PID:         pid,
+		ProcName:    procName,
+		RiskLevel:   result.RiskLevel,
+		RealExt:     result.RealExt,
+		DeclaredExt: result.DeclaredExt,
+		Message:     result.Message,
+	}, f.removeOrig)
 	if err != nil {
-		if os.IsNotExist(err) {
-			return "process exited too fast"
+		sysutil.LogSugar.Errorf("quarantine %s failed: %v", path, err)
+		// 原文件已删除时 item 不为空，隔离文件还在，ID 照常上报
+		if item == nil {
+			return ""
 		}
-		return "unknown"
 	}
-	return strings.TrimSpace(string(b))
+	sysutil.LogSugar.Warnf("🔒 Quarantined %s as %s (sha256=%s, removed=%v)", path, item.ID, item.SHA256, item.Removed)
+	return item.ID
+}
+
+func getProcExe(pid int) string {
+	exe, err := os.Readlink(filepath.Join("/proc", strconv.Itoa(pid), "exe"))
+	if err != nil {
+		return ""
+	}
+	return exe
 }
 
 func (f *fanotifyMonitor) Stop() {
 	close(f.stop)
+	// 唤醒读取协程，等它们退出后再关闭 fd，避免 fd 号被复用后读到别的文件
+	var one [8]byte
+	binary.NativeEndian.PutUint64(one[:], 1)
+	unix.Write(f.wake, one[:])
+	f.loops.Wait()
 	unix.Close(f.fdBlocker)
 	unix.Close(f.fdRecorder)
+	unix.Close(f.wake)
 }
 
 func (f *fanotifyMonitor) Events() <-chan model.FileEvent { return f.events }
 
+func (f *fanotifyMonitor) Findings() <-chan model.AnalysisEvent { return f.findings }
+
 func getEventOp(mask uint64) string {
 	var events []string
 	if mask&unix.FAN_OPEN_PERM == unix.FAN_OPEN_PERM {
@@ -353,9 +431,15 @@ func getEventOp(mask uint64) string {
 	if mask&unix.FAN_DELETE == unix.FAN_DELETE {
 		events = append(events, "DELETE")
 	}
+	if mask&unix.FAN_MOVED_FROM != 0 {
+		events = append(events, "MOVED_FROM")
+	}
 	if mask&unix.FAN_MOVED_TO != 0 {
 		events = append(events, "MOVED_TO")
 	}
+	if mask&unix.FAN_RENAME != 0 {
+		events = append(events, opRename)
+	}
 
 	if len(events) == 0 {
 		return fmt.Sprintf("OTHER(0x%x)", mask)
@@ -365,9 +449,18 @@ func getEventOp(mask uint64) string {
 
 // 统一回复 Allow
 func (f *fanotifyMonitor) replyAllow(fanotifyFd int, fileFd int32) {
+	f.reply(fanotifyFd, fileFd, unix.FAN_ALLOW)
+}
+
+// 统一回复 Deny，被拦截的进程会收到 EPERM
+func (f *fanotifyMonitor) replyDeny(fanotifyFd int, fileFd int32) {
+	f.reply(fanotifyFd, fileFd, unix.FAN_DENY)
+}
+
+func (f *fanotifyMonitor) reply(fanotifyFd int, fileFd int32, verdict uint32) {
 	response := unix.FanotifyResponse{
 		Fd:       fileFd,
-		Response: uint32(unix.FAN_ALLOW),
+		Response: verdict,
 	}
 	buf := (*[unsafe.Sizeof(response)]byte)(unsafe.Pointer(&response))[:]
 	unix.Write(fanotifyFd, buf)
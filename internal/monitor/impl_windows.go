@@ -2,13 +2,16 @@
 
 package monitor
 
-import "usbSentry/internal/model"
+import (
+	"github.com/Hara602/usbSentry/internal/model"
+)
 
 type winMonitor struct{}
 
-func newMonitor() (FileMonitor, error)               { return &winMonitor{}, nil }
-func (m *winMonitor) Start()                         {}
-func (m *winMonitor) Stop()                          {}
-func (m *winMonitor) AddWatch(p string) error        { return nil }
-func (m *winMonitor) RemoveWatch(p string)           {}
-func (m *winMonitor) Events() <-chan model.FileEvent { return nil }
+func newMonitor(cfg Config) (FileMonitor, error)             { return &winMonitor{}, nil }
+func (m *winMonitor) Start()                                 {}
+func (m *winMonitor) Stop()                                  {}
+func (m *winMonitor) AddWatch(dev model.DeviceContext) error { return nil }
+func (m *winMonitor) RemoveWatch(p string)                   {}
+func (m *winMonitor) Events() <-chan model.FileEvent         { return nil }
+func (m *winMonitor) Findings() <-chan model.AnalysisEvent   { return nil }
@@ -1,15 +1,29 @@
 package monitor
 
-import "github.com/Hara602/usbSentry/internal/model"
+import (
+	"github.com/Hara602/usbSentry/internal/model"
+	"github.com/Hara602/usbSentry/internal/policy"
+	"github.com/Hara602/usbSentry/internal/quarantine"
+)
 
 type FileMonitor interface {
 	Start()
 	Stop()
-	AddWatch(mountPath string) error // 动态添加监控 (Req 2)
+	AddWatch(dev model.DeviceContext) error // 动态添加监控 (Req 2)，监控 dev.MountPoint
 	RemoveWatch(mountPath string)
 	Events() <-chan model.FileEvent
+	Findings() <-chan model.AnalysisEvent // 文件类型伪装等分析结果
 }
 
-func New() (FileMonitor, error) {
-	return newMonitor()
+// Config 文件监控的可选组件
+type Config struct {
+	Policy         *policy.Engine    // 权限事件的 ALLOW/DENY 裁决，nil 表示全部放行
+	Quarantine     *quarantine.Store // 伪装文件隔离区，nil 表示只告警不隔离
+	RemoveOriginal bool              // 隔离后是否删除 U 盘上的原文件
+	FileType       bool              // 是否对写入完成的文件做类型伪装检测
+	Audit          bool              // 审计模式：策略拒绝的请求照常放行，verdict 记为 WOULD_DENY
+}
+
+func New(cfg Config) (FileMonitor, error) {
+	return newMonitor(cfg)
 }
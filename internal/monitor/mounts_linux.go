@@ -0,0 +1,228 @@
+//go:build linux
+
+package monitor
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/Hara602/usbSentry/internal/model"
+	"github.com/Hara602/usbSentry/internal/sysutil"
+	"golang.org/x/sys/unix"
+)
+
+// Blocker 监听：权限拦截 + 写入完成，这些事件都有 FD，路径精准
+const blockerMask = unix.FAN_CLOSE_WRITE |
+	unix.FAN_OPEN_PERM | // 拦截打开
+	unix.FAN_OPEN_EXEC_PERM | // 拦截执行
+	unix.FAN_EVENT_ON_CHILD
+
+// watchedFS 一个被监控的文件系统，以 fsid 区分
+// FAN_MARK_FILESYSTEM 标记的是整个文件系统：同一文件系统挂载在多处时只有一个标记，最后一个挂载点移除时才取消
+type watchedFS struct {
+	fsid      unix.Fsid
+	dev       uint64          // st_dev，用于在 fdinfo 中核对标记
+	mounts    []*watchedMount // 按 AddWatch 顺序，Recorder 还原路径时用第一个
+	inodeMark bool            // Recorder 不支持 FAN_MARK_FILESYSTEM，降级为只标记挂载点目录
+}
+
+// watchedMount 一个被监控的挂载点
+type watchedMount struct {
+	dev  *model.DeviceContext
+	fsid unix.Fsid
+}
+
+func (f *fanotifyMonitor) AddWatch(dev model.DeviceContext) error {
+	mountPath := dev.MountPoint
+	// fsid 和标记都通过同一个 fd 取得，保证是同一个文件系统
+	// 必须在加锁前打开：打开目录会触发 Blocker 的权限事件，读取协程处理事件时要拿读锁
+	dirFd, err := unix.Open(mountPath, unix.O_RDONLY|unix.O_DIRECTORY|unix.O_CLOEXEC, 0)
+	if err != nil {
+		return fmt.Errorf("open %s failed: %v", mountPath, err)
+	}
+	defer unix.Close(dirFd)
+	var sfs unix.Statfs_t
+	if err := unix.Fstatfs(dirFd, &sfs); err != nil {
+		return fmt.Errorf("statfs %s failed: %v", mountPath, err)
+	}
+	var st unix.Stat_t
+	if err := unix.Fstat(dirFd, &st); err != nil {
+		return fmt.Errorf("stat %s failed: %v", mountPath, err)
+	}
+	m := &watchedMount{dev: &dev, fsid: sfs.Fsid}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if fs, ok := f.fss[sfs.Fsid]; ok {
+		if f.marked(st.Dev) {
+			// 文件系统已经标记过 (bind mount、重复挂载或同一挂载点的新会话)，只更新挂载点表
+			fs.mounts = slices.DeleteFunc(fs.mounts, func(old *watchedMount) bool { return old.dev.MountPoint == mountPath })
+			fs.mounts = append(fs.mounts, m)
+			return nil
+		}
+		// 标记已经随旧的文件系统释放 (没收到 RemoveWatch 就卸载、重新挂载后 fsid 相同)，旧的挂载点和目录缓存都作废，重新标记
+		sysutil.LogSugar.Warnf("mark on %s is gone, marking the filesystem again", mountPath)
+		delete(f.fss, sfs.Fsid)
+		f.dirs.forget(sfs.Fsid)
+	}
+
+	fs := &watchedFS{fsid: sfs.Fsid, dev: st.Dev, mounts: []*watchedMount{m}}
+	if err := unix.FanotifyMark(f.fdBlocker, unix.FAN_MARK_ADD|unix.FAN_MARK_FILESYSTEM, blockerMask, dirFd, ""); err != nil {
+		return fmt.Errorf("blocker mark failed: %v", err)
+	}
+	// Recorder 监听：创建、删除、移动，这些事件没有 FD，但有文件名
+	if err := unix.FanotifyMark(f.fdRecorder, unix.FAN_MARK_ADD|unix.FAN_MARK_FILESYSTEM, f.recorderMask(), dirFd, ""); err != nil {
+		sysutil.LogSugar.Warnf("⚠️  Recorder MARK_FILESYSTEM on %s failed (%v), trying directory only mode...", mountPath, err)
+		fs.inodeMark = true
+		if err := unix.FanotifyMark(f.fdRecorder, unix.FAN_MARK_ADD, f.recorderMask(), dirFd, ""); err != nil {
+			// 回滚 Blocker 的标记
+			_ = unix.FanotifyMark(f.fdBlocker, unix.FAN_MARK_REMOVE|unix.FAN_MARK_FILESYSTEM, blockerMask, dirFd, "")
+			return fmt.Errorf("recorder mark failed: %v", err)
+		}
+	}
+	f.fss[sfs.Fsid] = fs
+
+	// 先记下根目录，根目录下的 Recorder 事件在 FAT 上也能还原
+	f.dirs.learn(mountPath, sfs.Fsid, true)
+	return nil
+}
+
+func (f *fanotifyMonitor) RemoveWatch(mountPath string) {
+	f.mu.Lock()
+	var fs *watchedFS
+	for _, candidate := range f.fss {
+		n := len(candidate.mounts)
+		candidate.mounts = slices.DeleteFunc(candidate.mounts, func(m *watchedMount) bool { return m.dev.MountPoint == mountPath })
+		if len(candidate.mounts) != n {
+			fs = candidate
+			break
+		}
+	}
+	if fs == nil || len(fs.mounts) > 0 {
+		// 没有监控过，或者同一文件系统还有别的挂载点
+		f.mu.Unlock()
+		return
+	}
+	delete(f.fss, fs.fsid)
+	f.mu.Unlock()
+
+	// 卸载后 fsid 可能被下一个 U 盘复用 (FAT 的 fsid 由设备号生成)，缓存的目录不能留
+	f.dirs.forget(fs.fsid)
+	f.unmark(fs, mountPath)
+}
+
+// unmark 两个 fd 上都按添加时的方式移除标记，并在 fdinfo 中核对
+// 通常此时 U 盘已经卸载：文件系统释放时内核会自动清掉标记，挂载点路径已经属于上层文件系统，不能再对它 REMOVE
+func (f *fanotifyMonitor) unmark(fs *watchedFS, mountPath string) {
+	mounted := false
+	dirFd, err := unix.Open(mountPath, unix.O_RDONLY|unix.O_DIRECTORY|unix.O_CLOEXEC, 0)
+	if err == nil {
+		defer unix.Close(dirFd)
+		var sfs unix.Statfs_t
+		mounted = unix.Fstatfs(dirFd, &sfs) == nil && sfs.Fsid == fs.fsid
+	}
+
+	recorderFlags := uint(unix.FAN_MARK_REMOVE | unix.FAN_MARK_FILESYSTEM)
+	if fs.inodeMark {
+		recorderFlags = unix.FAN_MARK_REMOVE
+	}
+	marks := []struct {
+		role  string
+		fd    int
+		flags uint
+		mask  uint64
+	}{
+		{"Blocker", f.fdBlocker, unix.FAN_MARK_REMOVE | unix.FAN_MARK_FILESYSTEM, blockerMask},
+		{"Recorder", f.fdRecorder, recorderFlags, f.recorderMask()},
+	}
+	for _, mk := range marks {
+		if mounted {
+			if err := unix.FanotifyMark(mk.fd, mk.flags, mk.mask, dirFd, ""); err != nil {
+				sysutil.LogSugar.Warnf("%s: removing mark on %s failed: %v", mk.role, mountPath, err)
+			}
+		}
+		present, err := hasMark(mk.fd, fs.dev)
+		switch {
+		case err != nil || !present:
+		case mounted:
+			sysutil.LogSugar.Warnf("%s: mark on %s is still present after removal", mk.role, mountPath)
+		default:
+			// 懒卸载 (umount -l) 等情况下文件系统还没释放，路径已经找不到它了
+			sysutil.LogSugar.Infof("%s: %s is no longer mounted, its mark goes away when the filesystem is released", mk.role, mountPath)
+		}
+	}
+}
+
+// marked 两个 fanotify fd 上是否都还有设备 dev 上的标记，无法确认时按没有处理 (重复 FAN_MARK_ADD 没有副作用)
+func (f *fanotifyMonitor) marked(dev uint64) bool {
+	for _, fd := range []int{f.fdBlocker, f.fdRecorder} {
+		if present, err := hasMark(fd, dev); err != nil || !present {
+			return false
+		}
+	}
+	return true
+}
+
+// hasMark 查看 /proc/self/fdinfo，fanotify fd 上是否还有设备 dev 上的标记
+// 每个标记一行，如 "fanotify sdev:800011 mflags:0 mask:..." 或 "fanotify ino:2 sdev:800011 ..."
+func hasMark(fanFd int, dev uint64) (bool, error) {
+	file, err := os.Open("/proc/self/fdinfo/" + strconv.Itoa(fanFd))
+	if err != nil {
+		return false, err
+	}
+	defer file.Close()
+	// fdinfo 里是内核内部的设备号格式 (major << 20 | minor)
+	sdev := "sdev:" + strconv.FormatUint(uint64(unix.Major(dev))<<20|uint64(unix.Minor(dev)), 16)
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if strings.HasPrefix(line, "fanotify ") && slices.Contains(strings.Fields(line), sdev) {
+			return true, nil
+		}
+	}
+	return false, scanner.Err()
+}
+
+// mountFor 按 fsid 找挂载点；同一文件系统有多个挂载点时按路径前缀选，选不出来用第一个
+func (f *fanotifyMonitor) mountFor(fsid unix.Fsid, path string) *watchedMount {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	fs, ok := f.fss[fsid]
+	if !ok {
+		return nil
+	}
+	best := fs.mounts[0]
+	bestLen := -1
+	for _, m := range fs.mounts {
+		mount := m.dev.MountPoint
+		if path != mount && !strings.HasPrefix(path, strings.TrimSuffix(mount, "/")+"/") {
+			continue
+		}
+		if len(mount) > bestLen {
+			best, bestLen = m, len(mount)
+		}
+	}
+	return best
+}
+
+// watching 文件系统是否被监控
+func (f *fanotifyMonitor) watching(fsid unix.Fsid) bool {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	_, ok := f.fss[fsid]
+	return ok
+}
+
+// mountForFsid 找出 fsid 对应的挂载点，Recorder 的路径还原到这个挂载点下
+func (f *fanotifyMonitor) mountForFsid(fsid unix.Fsid) (string, bool) {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	if fs, ok := f.fss[fsid]; ok {
+		return fs.mounts[0].dev.MountPoint, true
+	}
+	return "", false
+}
@@ -0,0 +1,103 @@
+//go:build linux
+
+package monitor
+
+import (
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"golang.org/x/sys/unix"
+)
+
+// openForWrite 判断进程正在进行的 open 是否带写意图
+// fanotify 的 FAN_OPEN_PERM 不携带原始 open flags，但此时进程正阻塞在 openat 系统调用里，
+// 可以从 /proc/<pid>/task/<tid>/syscall 读到系统调用号和参数。
+// 读不到时 (进程已退出、32 位兼容调用、io_uring 等) 返回 ok=false
+// 事件只带进程 ID，不知道是哪个线程：只要有一个线程正在写打开就算写，
+// 所以多线程进程读文件时，如果另一个线程恰好在写打开，读也会按写处理
+func openForWrite(pid int) (write bool, ok bool) {
+	// 主线程最常见，先看它
+	if flags, found := pendingOpenFlags(pid, pid); found {
+		return isWriteFlags(flags), true
+	}
+
+	// 多线程进程：遍历所有线程，任何一个线程在做写打开都视为写
+	tasks, err := os.ReadDir(filepath.Join("/proc", strconv.Itoa(pid), "task"))
+	if err != nil {
+		return false, false
+	}
+	for _, t := range tasks {
+		tid, err := strconv.Atoi(t.Name())
+		if err != nil || tid == pid {
+			continue
+		}
+		if flags, found := pendingOpenFlags(pid, tid); found {
+			ok = true
+			if isWriteFlags(flags) {
+				return true, true
+			}
+		}
+	}
+	return false, ok
+}
+
+// pendingOpenFlags 读取线程当前阻塞的 openat/openat2 调用的 flags 参数
+func pendingOpenFlags(pid, tid int) (uint64, bool) {
+	path := filepath.Join("/proc", strconv.Itoa(pid), "task", strconv.Itoa(tid), "syscall")
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return 0, false
+	}
+	// 格式: "<nr> <arg0> ... <arg5> <sp> <pc>"，参数为十六进制；不在系统调用中时为 "running" 等
+	fields := strings.Fields(string(b))
+	if len(fields) < 7 {
+		return 0, false
+	}
+	nr, err := strconv.ParseInt(fields[0], 10, 64)
+	if err != nil {
+		return 0, false
+	}
+	var args [6]uint64
+	for i := range args {
+		if args[i], err = strconv.ParseUint(strings.TrimPrefix(fields[i+1], "0x"), 16, 64); err != nil {
+			return 0, false
+		}
+	}
+
+	switch nr {
+	case unix.SYS_OPENAT:
+		// openat(dirfd, pathname, flags, mode)
+		return args[2], true
+	case unix.SYS_OPENAT2:
+		// openat2(dirfd, pathname, struct open_how *how, size)，flags 是 open_how 的第一个 u64
+		return readOpenHowFlags(pid, args[2])
+	case unix.SYS_OPEN_BY_HANDLE_AT:
+		// open_by_handle_at(mount_fd, handle, flags)
+		return args[2], true
+	case unix.SYS_EXECVE, unix.SYS_EXECVEAT:
+		// exec 打开可执行文件时除了 OPEN_EXEC_PERM 也会产生 OPEN_PERM，只读
+		return unix.O_RDONLY, true
+	}
+	return legacyOpenFlags(nr, args)
+}
+
+func readOpenHowFlags(pid int, addr uint64) (uint64, bool) {
+	f, err := os.Open(filepath.Join("/proc", strconv.Itoa(pid), "mem"))
+	if err != nil {
+		return 0, false
+	}
+	defer f.Close()
+	var buf [8]byte
+	if _, err := f.ReadAt(buf[:], int64(addr)); err != nil {
+		return 0, false
+	}
+	return binary.NativeEndian.Uint64(buf[:]), true
+}
+
+func isWriteFlags(flags uint64) bool {
+	acc := flags & unix.O_ACCMODE
+	return acc == unix.O_WRONLY || acc == unix.O_RDWR || flags&(unix.O_TRUNC|unix.O_CREAT) != 0
+}
@@ -0,0 +1,18 @@
+//go:build linux && amd64
+
+package monitor
+
+import "golang.org/x/sys/unix"
+
+// legacyOpenFlags amd64 上还保留了老的 open(2) 和 creat(2)
+func legacyOpenFlags(nr int64, args [6]uint64) (uint64, bool) {
+	switch nr {
+	case unix.SYS_OPEN:
+		// open(pathname, flags, mode)
+		return args[1], true
+	case unix.SYS_CREAT:
+		// creat(pathname, mode) 等价于 O_CREAT|O_WRONLY|O_TRUNC
+		return unix.O_CREAT | unix.O_WRONLY | unix.O_TRUNC, true
+	}
+	return 0, false
+}
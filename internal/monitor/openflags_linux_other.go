@@ -0,0 +1,8 @@
+//go:build linux && !amd64
+
+package monitor
+
+// legacyOpenFlags 其他架构只按 openat 系列判断
+func legacyOpenFlags(nr int64, args [6]uint64) (uint64, bool) {
+	return 0, false
+}
@@ -0,0 +1,227 @@
+//go:build linux
+
+package monitor
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/Hara602/usbSentry/internal/model"
+	"golang.org/x/sys/unix"
+)
+
+// AT_HANDLE_FID (Linux 6.5+)：为不支持导出的文件系统 (FAT 等) 生成与 fanotify 一致的 handle
+// x/sys 里还没有这个常量
+const atHandleFID = 0x200
+
+// dirFid Recorder 事件中的父目录 (fsid + file handle) 和文件名，FID 信息中为对象本身的 handle
+type dirFid struct {
+	fsid   unix.Fsid
+	handle unix.FileHandle
+	name   string
+}
+
+// key 目录缓存的 key，同一目录改名后 handle 不变
+func (d dirFid) key() string {
+	return handleKey(d.fsid, d.handle)
+}
+
+func handleKey(fsid unix.Fsid, h unix.FileHandle) string {
+	return fsidKey(fsid) + strconv.Itoa(int(h.Type())) + ":" + string(h.Bytes())
+}
+
+// fsidKey handleKey 的前缀，同一文件系统的 key 都以它开头
+func fsidKey(fsid unix.Fsid) string {
+	return strconv.Itoa(int(fsid.Val[0])) + ":" + strconv.Itoa(int(fsid.Val[1])) + ":"
+}
+
+// parseFids 解析事件后面的 fid 信息，按信息类型 (DFID_NAME / OLD_DFID_NAME / NEW_DFID_NAME / FID) 返回
+// FID 类型没有文件名
+func parseFids(buf []byte) map[uint8]dirFid {
+	reader := bytes.NewReader(buf)
+	// 跳过 Metadata
+	if _, err := reader.Seek(int64(model.FanotifyEventMetadataSize), io.SeekStart); err != nil {
+		return nil
+	}
+
+	fids := make(map[uint8]dirFid)
+	for {
+		var infoFid model.FanotifyEventInfoFid
+		if err := binary.Read(reader, binary.LittleEndian, &infoFid); err != nil {
+			break
+		}
+		infoType := infoFid.Hdr.InfoType
+
+		switch infoType {
+		case unix.FAN_EVENT_INFO_TYPE_FID, unix.FAN_EVENT_INFO_TYPE_DFID_NAME,
+			unix.FAN_EVENT_INFO_TYPE_OLD_DFID_NAME, unix.FAN_EVENT_INFO_TYPE_NEW_DFID_NAME:
+		default:
+			// 跳过其他信息
+			pad := int(infoFid.Hdr.Len) - binary.Size(infoFid)
+			if pad > 0 {
+				reader.Seek(int64(pad), io.SeekCurrent)
+			}
+			continue
+		}
+
+		var fileHandle model.FileHandle
+		if err := binary.Read(reader, binary.LittleEndian, &fileHandle); err != nil {
+			break
+		}
+		handle := make([]byte, fileHandle.HandleBytes)
+		if _, err := io.ReadFull(reader, handle); err != nil {
+			break
+		}
+
+		// 剩下的是文件名 (以 null 结尾，可能有对齐填充)；FID 类型只有填充
+		headerSize := binary.Size(infoFid) + binary.Size(fileHandle)
+		rest := int(infoFid.Hdr.Len) - headerSize - int(fileHandle.HandleBytes)
+		name := ""
+		if rest > 0 {
+			nameBuf := make([]byte, rest)
+			if _, err := io.ReadFull(reader, nameBuf); err != nil {
+				break
+			}
+			if idx := bytes.IndexByte(nameBuf, 0); idx != -1 {
+				nameBuf = nameBuf[:idx]
+			}
+			if infoType != unix.FAN_EVENT_INFO_TYPE_FID {
+				name = string(nameBuf)
+			}
+		}
+		fids[infoType] = dirFid{
+			fsid:   infoFid.Fsid,
+			handle: unix.NewFileHandle(int32(fileHandle.HandleType), handle),
+			name:   name,
+		}
+	}
+	return fids
+}
+
+// dirCache 目录 handle -> 路径
+// FAT/exFAT 不支持 open_by_handle_at，只能靠 Blocker 事件 (有 fd，路径精确) 和目录创建/移动事件提前记下目录
+type dirCache struct {
+	mu    sync.Mutex
+	dirs  map[string]string   // handle key -> 路径
+	known map[string]struct{} // 已经记录过的路径，避免对同一目录反复 name_to_handle_at
+}
+
+const maxDirCacheEntries = 16384
+
+func newDirCache() *dirCache {
+	return &dirCache{dirs: make(map[string]string), known: make(map[string]struct{})}
+}
+
+func (c *dirCache) get(key string) (string, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	dir, ok := c.dirs[key]
+	return dir, ok
+}
+
+func (c *dirCache) put(key, dir string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	// 简单粗暴的上限：满了就整体清空
+	if len(c.dirs) >= maxDirCacheEntries {
+		c.dirs = make(map[string]string)
+		c.known = make(map[string]struct{})
+	}
+	c.dirs[key] = dir
+	c.known[dir] = struct{}{}
+}
+
+// forget 清掉一个文件系统的全部目录
+func (c *dirCache) forget(fsid unix.Fsid) {
+	prefix := fsidKey(fsid)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for key, dir := range c.dirs {
+		if strings.HasPrefix(key, prefix) {
+			delete(c.dirs, key)
+			delete(c.known, dir)
+		}
+	}
+}
+
+// move 目录改名后，把它自己和下面所有子目录的路径前缀从 oldDir 改成 newDir
+func (c *dirCache) move(oldDir, newDir string) {
+	prefix := oldDir + "/"
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for key, dir := range c.dirs {
+		if dir != oldDir && !strings.HasPrefix(dir, prefix) {
+			continue
+		}
+		moved := newDir + strings.TrimPrefix(dir, oldDir)
+		c.dirs[key] = moved
+		delete(c.known, dir)
+		c.known[moved] = struct{}{}
+	}
+}
+
+// learn 记下目录的 handle；force 为 false 时已记录过的路径直接跳过
+// 目录被移动或重建后需要 force，handle 不变时新路径会覆盖旧路径
+func (c *dirCache) learn(dir string, fsid unix.Fsid, force bool) {
+	if !force {
+		c.mu.Lock()
+		_, ok := c.known[dir]
+		c.mu.Unlock()
+		if ok {
+			return
+		}
+	}
+	h, _, err := unix.NameToHandleAt(unix.AT_FDCWD, dir, 0)
+	if err != nil {
+		// 不支持导出的文件系统，fanotify 上报的是 AT_HANDLE_FID 形式的 handle
+		if h, _, err = unix.NameToHandleAt(unix.AT_FDCWD, dir, atHandleFID); err != nil {
+			return
+		}
+	}
+	c.put(handleKey(fsid, h), dir)
+}
+
+// resolvePath 还原 Recorder 事件的完整路径，返回路径和可信度 (model.PathFrom*)
+func (f *fanotifyMonitor) resolvePath(fid dirFid) (string, string) {
+	mount, ok := f.mountForFsid(fid.fsid)
+	if !ok {
+		return filepath.Join("...", fid.name), model.PathUnresolved
+	}
+	// 能用 handle 时以它为准，缓存只给 FAT/exFAT 等不支持的文件系统兜底
+	if dir, ok := openDirByHandle(mount, fid.handle); ok {
+		return filepath.Join(dir, fid.name), model.PathFromHandle
+	}
+	if dir, ok := f.dirs.get(fid.key()); ok {
+		return filepath.Join(dir, fid.name), model.PathFromCache
+	}
+	// 简单降级：拼接到挂载点根目录
+	return filepath.Join(mount, "...", fid.name), model.PathUnresolved
+}
+
+// openDirByHandle 用 open_by_handle_at 找到目录的当前路径
+// 挂载点的 fd 每次临时打开：一直持有会导致用户无法卸载 U 盘
+func openDirByHandle(mount string, handle unix.FileHandle) (string, bool) {
+	mountFd, err := unix.Open(mount, unix.O_RDONLY|unix.O_DIRECTORY|unix.O_CLOEXEC, 0)
+	if err != nil {
+		return "", false
+	}
+	defer unix.Close(mountFd)
+
+	fd, err := unix.OpenByHandleAt(mountFd, handle, unix.O_PATH|unix.O_CLOEXEC)
+	if err != nil {
+		return "", false
+	}
+	defer unix.Close(fd)
+
+	dir, err := os.Readlink("/proc/self/fd/" + strconv.Itoa(fd))
+	if err != nil || strings.HasSuffix(dir, " (deleted)") {
+		return "", false
+	}
+	return dir, true
+}
@@ -0,0 +1,332 @@
+//go:build linux
+
+package monitor
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"os"
+	"os/user"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Hara602/usbSentry/internal/model"
+	"golang.org/x/sys/unix"
+)
+
+const (
+	maxProcCacheEntries = 4096
+	maxAncestors        = 16
+	maxExeHashSize      = 256 << 20 // 更大的可执行文件不算哈希
+	exeHashQueue        = 256       // 待计算哈希的进程，满了就丢弃
+	clockTicks          = 100       // USER_HZ，Linux 各架构上都是 100
+	auditUnset          = ^uint32(0)
+)
+
+// 常见容器运行时的 cgroup 路径：/docker/<id>、docker-<id>.scope、cri-containerd-<id>.scope、libpod-<id>.scope
+var containerIDRe = regexp.MustCompile(`(?:^|[/-])([0-9a-f]{64})(?:\.scope)?(?:/|$)`)
+
+// procCache 按 PID 缓存进程详情，用进程启动时间校验，PID 被复用或 exec 后重新读取
+// 进程退出后仍保留条目，之后同一 PID 的事件 (如 DELETE 晚到) 还能归属到它
+type procCache struct {
+	mu      sync.Mutex
+	entries map[int32]*model.ProcessInfo
+	users   map[uint32]string
+	hashes  *hashCache
+	watched func(unix.Fsid) bool // 文件系统是否被监控
+	jobs    chan exeHashJob
+	bootAt  time.Time
+}
+
+// exeHashJob 一个等待计算 exe 哈希的进程
+type exeHashJob struct {
+	pid   int32
+	start time.Time
+	exe   string
+}
+
+// newProcCache 可执行文件的哈希由后台协程计算，算好后填回缓存，之后的事件才带上 exe_sha256
+// 读取协程里不能打开文件：文件在被监控的 U 盘上时，自己的 open 产生的权限事件只有被卡住的读取协程能回复
+func newProcCache(hashes *hashCache, watched func(unix.Fsid) bool, stop <-chan struct{}) *procCache {
+	c := &procCache{
+		entries: make(map[int32]*model.ProcessInfo),
+		users:   make(map[uint32]string),
+		hashes:  hashes,
+		watched: watched,
+		jobs:    make(chan exeHashJob, exeHashQueue),
+		bootAt:  bootTime(),
+	}
+	go c.hashWorker(stop)
+	return c
+}
+
+// get 返回进程详情，读不到 /proc 且没有缓存时只有 PID，Exited 为 true
+// 返回值可能被多个事件共享，调用方不要修改
+func (c *procCache) get(pid int32) *model.ProcessInfo {
+	return c.lookup(pid, maxAncestors)
+}
+
+func (c *procCache) lookup(pid int32, depth int) *model.ProcessInfo {
+	st, err := readProcStat(pid)
+
+	c.mu.Lock()
+	cached := c.entries[pid]
+	c.mu.Unlock()
+	if err != nil {
+		if cached != nil {
+			return cached
+		}
+		return &model.ProcessInfo{PID: pid, Exited: true}
+	}
+	// exec 不改变启动时间，还要核对进程名和 exe
+	if cached != nil && cached.StartTime.Equal(c.startTime(st.startTicks)) &&
+		cached.Name == st.comm && cached.Exe == getProcExe(int(pid)) {
+		return cached
+	}
+
+	info := c.collect(pid, st, depth)
+	c.mu.Lock()
+	// 简单粗暴的上限：满了就整体清空
+	if len(c.entries) >= maxProcCacheEntries {
+		c.entries = make(map[int32]*model.ProcessInfo)
+	}
+	c.entries[pid] = info
+	c.mu.Unlock()
+	return info
+}
+
+func (c *procCache) collect(pid int32, st procStat, depth int) *model.ProcessInfo {
+	dir := filepath.Join("/proc", strconv.Itoa(int(pid)))
+	info := &model.ProcessInfo{
+		PID:       pid,
+		PPID:      st.ppid,
+		Name:      st.comm,
+		Exe:       getProcExe(int(pid)),
+		TTY:       ttyName(st.ttyNr),
+		StartTime: c.startTime(st.startTicks),
+	}
+	if b, err := os.ReadFile(filepath.Join(dir, "comm")); err == nil {
+		info.Name = strings.TrimSpace(string(b))
+	}
+	if b, err := os.ReadFile(filepath.Join(dir, "cmdline")); err == nil && len(b) > 0 {
+		info.Cmdline = strings.Split(strings.TrimSuffix(string(b), "\x00"), "\x00")
+	}
+	if uid, euid, ok := readProcUIDs(dir); ok {
+		info.UID, info.User = uid, c.userName(uid)
+		info.EUID, info.EUser = euid, c.userName(euid)
+	}
+	if id, ok := readProcUint32(filepath.Join(dir, "loginuid")); ok && id != auditUnset {
+		info.LoginUID, info.LoginUser = &id, c.userName(id)
+	}
+	if id, ok := readProcUint32(filepath.Join(dir, "sessionid")); ok && id != auditUnset {
+		info.AuditSessID = &id
+	}
+	info.Cgroup = readCgroup(dir)
+	if m := containerIDRe.FindStringSubmatch(info.Cgroup); m != nil {
+		info.ContainerID = m[1]
+	}
+	if info.Exe != "" {
+		select {
+		case c.jobs <- exeHashJob{pid: pid, start: info.StartTime, exe: info.Exe}:
+		default:
+		}
+	}
+
+	// 父进程链：父进程同样走缓存
+	if depth > 0 && st.ppid > 0 {
+		parent := c.lookup(st.ppid, depth-1)
+		if !parent.Exited {
+			info.Ancestors = append([]model.ProcessRef{{PID: parent.PID, Name: parent.Name, Exe: parent.Exe}}, parent.Ancestors...)
+			if len(info.Ancestors) > maxAncestors {
+				info.Ancestors = info.Ancestors[:maxAncestors]
+			}
+		}
+	}
+	return info
+}
+
+func (c *procCache) hashWorker(stop <-chan struct{}) {
+	for {
+		select {
+		case <-stop:
+			return
+		case job := <-c.jobs:
+			c.hashExe(job)
+		}
+	}
+}
+
+// hashExe 计算进程 exe 的哈希并填回缓存
+// 缓存里的条目可能已经被事件引用，不能原地修改，换成一份副本
+func (c *procCache) hashExe(job exeHashJob) {
+	// 通过 /proc/<pid>/exe 打开，文件被删除或替换后算的仍是正在运行的那个
+	exe := filepath.Join("/proc", strconv.Itoa(int(job.pid)), "exe")
+	var sfs unix.Statfs_t
+	if err := unix.Statfs(exe, &sfs); err != nil || c.watched(sfs.Fsid) {
+		// U 盘上的程序不算：读它会产生权限事件，而且可能很慢
+		return
+	}
+	if st, err := readProcStat(job.pid); err != nil || !c.startTime(st.startTicks).Equal(job.start) || getProcExe(int(job.pid)) != job.exe {
+		return
+	}
+	sum, err := c.hashes.hashPath(exe, maxExeHashSize)
+	if err != nil {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if e := c.entries[job.pid]; e != nil && e.StartTime.Equal(job.start) && e.Exe == job.exe && e.ExeSHA256 == "" {
+		updated := *e
+		updated.ExeSHA256 = sum
+		c.entries[job.pid] = &updated
+	}
+}
+
+func (c *procCache) startTime(ticks uint64) time.Time {
+	return c.bootAt.Add(time.Duration(ticks) * time.Second / clockTicks)
+}
+
+func (c *procCache) userName(uid uint32) string {
+	c.mu.Lock()
+	name, ok := c.users[uid]
+	c.mu.Unlock()
+	if ok {
+		return name
+	}
+	if u, err := user.LookupId(strconv.FormatUint(uint64(uid), 10)); err == nil {
+		name = u.Username
+	}
+	c.mu.Lock()
+	c.users[uid] = name
+	c.mu.Unlock()
+	return name
+}
+
+// procStat /proc/<pid>/stat 中用到的字段
+type procStat struct {
+	comm       string
+	ppid       int32
+	ttyNr      uint32
+	startTicks uint64 // 启动时间，开机以来的 clock tick
+}
+
+func readProcStat(pid int32) (procStat, error) {
+	b, err := os.ReadFile(filepath.Join("/proc", strconv.Itoa(int(pid)), "stat"))
+	if err != nil {
+		return procStat{}, err
+	}
+	// comm 可能包含空格和括号，以最后一个 ')' 为界
+	open, end := bytes.IndexByte(b, '('), bytes.LastIndexByte(b, ')')
+	if open < 0 || end < open {
+		return procStat{}, fmt.Errorf("malformed stat for pid %d", pid)
+	}
+	// 从第 3 个字段 (state) 开始
+	fields := strings.Fields(string(b[end+1:]))
+	if len(fields) < 20 {
+		return procStat{}, fmt.Errorf("malformed stat for pid %d", pid)
+	}
+	ppid, _ := strconv.ParseInt(fields[1], 10, 32)
+	tty, _ := strconv.ParseInt(fields[4], 10, 64)
+	start, err := strconv.ParseUint(fields[19], 10, 64)
+	if err != nil {
+		return procStat{}, fmt.Errorf("malformed stat for pid %d", pid)
+	}
+	return procStat{comm: string(b[open+1 : end]), ppid: int32(ppid), ttyNr: uint32(tty), startTicks: start}, nil
+}
+
+// readProcUIDs 读取 /proc/<pid>/status 中的 real 和 effective uid
+func readProcUIDs(dir string) (uid, euid uint32, ok bool) {
+	f, err := os.Open(filepath.Join(dir, "status"))
+	if err != nil {
+		return 0, 0, false
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		rest, found := strings.CutPrefix(scanner.Text(), "Uid:")
+		if !found {
+			continue
+		}
+		ids := strings.Fields(rest)
+		if len(ids) < 2 {
+			return 0, 0, false
+		}
+		r, err1 := strconv.ParseUint(ids[0], 10, 32)
+		e, err2 := strconv.ParseUint(ids[1], 10, 32)
+		return uint32(r), uint32(e), err1 == nil && err2 == nil
+	}
+	return 0, 0, false
+}
+
+func readProcUint32(path string) (uint32, bool) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return 0, false
+	}
+	v, err := strconv.ParseUint(strings.TrimSpace(string(b)), 10, 32)
+	return uint32(v), err == nil
+}
+
+// readCgroup 优先取 cgroup v2 的统一层级，否则取第一行的路径
+func readCgroup(dir string) string {
+	b, err := os.ReadFile(filepath.Join(dir, "cgroup"))
+	if err != nil {
+		return ""
+	}
+	first := ""
+	for _, line := range strings.Split(strings.TrimSpace(string(b)), "\n") {
+		parts := strings.SplitN(line, ":", 3)
+		if len(parts) != 3 {
+			continue
+		}
+		if parts[0] == "0" && parts[1] == "" {
+			return parts[2]
+		}
+		if first == "" {
+			first = parts[2]
+		}
+	}
+	return first
+}
+
+// ttyName 把 stat 中的 tty_nr 转换成设备名，没有控制终端时为空
+func ttyName(nr uint32) string {
+	if nr == 0 {
+		return ""
+	}
+	major := (nr >> 8) & 0xfff
+	minor := (nr & 0xff) | ((nr >> 12) & 0xfff00)
+	switch {
+	case major >= 136 && major <= 143: // Unix98 pty
+		return "pts/" + strconv.Itoa(int((major-136)*256+minor))
+	case major == 4 && minor < 64:
+		return "tty" + strconv.Itoa(int(minor))
+	case major == 4:
+		return "ttyS" + strconv.Itoa(int(minor-64))
+	}
+	return fmt.Sprintf("%d:%d", major, minor)
+}
+
+// bootTime 开机时间 (/proc/stat 的 btime)，读不到时退化为零值
+func bootTime() time.Time {
+	f, err := os.Open("/proc/stat")
+	if err != nil {
+		return time.Time{}
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		if rest, ok := strings.CutPrefix(scanner.Text(), "btime "); ok {
+			if sec, err := strconv.ParseInt(strings.TrimSpace(rest), 10, 64); err == nil {
+				return time.Unix(sec, 0)
+			}
+		}
+	}
+	return time.Time{}
+}
@@ -0,0 +1,113 @@
+//go:build linux
+
+package monitor
+
+import (
+	"encoding/binary"
+	"errors"
+	"time"
+
+	"github.com/Hara602/usbSentry/internal/metrics"
+	"github.com/Hara602/usbSentry/internal/model"
+	"github.com/Hara602/usbSentry/internal/sysutil"
+	"golang.org/x/sys/unix"
+)
+
+// 一次 read 能带回的事件越多，系统调用越少；带文件名的 Recorder 事件单个可达几百字节
+const readBufSize = 64 * 1024
+
+// readLoop 用 poll 同时等待 fanotify fd 和 wake (eventfd)，空闲时不占 CPU
+// wake 可读说明 Stop 被调用，直接退出
+func (f *fanotifyMonitor) readLoop(fd int, role string) {
+	defer f.loops.Done()
+
+	buf := make([]byte, readBufSize)
+	fds := []unix.PollFd{
+		{Fd: int32(fd), Events: unix.POLLIN},
+		{Fd: int32(f.wake), Events: unix.POLLIN},
+	}
+	for {
+		if _, err := unix.Poll(fds, -1); err != nil {
+			if errors.Is(err, unix.EINTR) {
+				continue
+			}
+			metrics.FanotifyReadErrors.WithLabelValues(role).Inc()
+			sysutil.LogSugar.Errorf("%s: poll failed, stop reading: %v", role, err)
+			return
+		}
+		if fds[1].Revents != 0 {
+			return
+		}
+		if fds[0].Revents&(unix.POLLERR|unix.POLLNVAL) != 0 {
+			metrics.FanotifyReadErrors.WithLabelValues(role).Inc()
+			sysutil.LogSugar.Errorf("%s: fanotify fd is no longer readable (revents=%#x)", role, fds[0].Revents)
+			return
+		}
+		f.drain(fd, role, buf)
+	}
+}
+
+// drain 一直读到 EAGAIN，每次 read 的结果作为一批处理
+func (f *fanotifyMonitor) drain(fd int, role string, buf []byte) {
+	for first := true; ; first = false {
+		select {
+		case <-f.stop:
+			return
+		default:
+		}
+
+		n, err := unix.Read(fd, buf)
+		switch {
+		case errors.Is(err, unix.EAGAIN):
+			// 被唤醒却什么也没读到
+			if first {
+				metrics.EmptyReads.WithLabelValues(role).Inc()
+			}
+			return
+		case errors.Is(err, unix.EINTR):
+			continue
+		case err != nil:
+			// 其他错误简单记录，回到 poll
+			metrics.FanotifyReadErrors.WithLabelValues(role).Inc()
+			return
+		}
+		f.processBatch(fd, role, buf[:n], time.Now())
+	}
+}
+
+// rawEvent 一批中的一个事件
+type rawEvent struct {
+	metadata unix.FanotifyEventMetadata
+	buf      []byte
+}
+
+// processBatch 拆出一次 read 中的所有事件
+// 权限事件先处理：期间访问文件的进程是挂起的，不要让它们排在 CLOSE_WRITE 等通知事件后面
+func (f *fanotifyMonitor) processBatch(fd int, role string, buf []byte, readAt time.Time) {
+	var perms, notifs []rawEvent
+	for offset := 0; offset+model.FanotifyEventMetadataSize <= len(buf); {
+		var metadata unix.FanotifyEventMetadata
+		if _, err := binary.Decode(buf[offset:], binary.LittleEndian, &metadata); err != nil {
+			sysutil.LogSugar.Errorf("fanotify metadata read failed: %v", err)
+			break
+		}
+		// 检查完整性
+		if metadata.Event_len < uint32(model.FanotifyEventMetadataSize) || offset+int(metadata.Event_len) > len(buf) {
+			break
+		}
+		ev := rawEvent{metadata: metadata, buf: buf[offset : offset+int(metadata.Event_len)]}
+		if metadata.Mask&permEvents != 0 {
+			perms = append(perms, ev)
+		} else {
+			notifs = append(notifs, ev)
+		}
+		offset += int(metadata.Event_len)
+	}
+
+	for _, ev := range perms {
+		f.processOneEvent(fd, role, ev.buf, ev.metadata, readAt)
+	}
+	for _, ev := range notifs {
+		f.processOneEvent(fd, role, ev.buf, ev.metadata, readAt)
+	}
+}
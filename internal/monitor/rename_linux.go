@@ -0,0 +1,80 @@
+//go:build linux
+
+package monitor
+
+import (
+	"sync"
+	"time"
+
+	"github.com/Hara602/usbSentry/internal/model"
+)
+
+// 没有 FAN_RENAME 的内核上，一次 rename 会产生紧挨着的 MOVED_FROM + MOVED_TO，
+// 事件里没有 cookie，只能按进程和时间配对：同一进程在 moveWindow 内的 MOVED_TO 视为同一次改名
+const moveWindow = 200 * time.Millisecond
+
+// movePairer 暂存等待配对的 MOVED_FROM
+type movePairer struct {
+	mu      sync.Mutex
+	pending *pendingMove
+	emit    func(model.FileEvent) // 超时未配对时单独上报 MOVED_FROM
+}
+
+type pendingMove struct {
+	ev    model.FileEvent
+	timer *time.Timer
+}
+
+func newMovePairer(emit func(model.FileEvent)) *movePairer {
+	return &movePairer{emit: emit}
+}
+
+// from 暂存 MOVED_FROM，之前还没配对的直接上报
+func (p *movePairer) from(ev model.FileEvent) {
+	p.mu.Lock()
+	prev := p.take()
+	pm := &pendingMove{ev: ev}
+	pm.timer = time.AfterFunc(moveWindow, func() {
+		p.mu.Lock()
+		expired := p.pending == pm
+		if expired {
+			p.pending = nil
+		}
+		p.mu.Unlock()
+		if expired {
+			p.emit(pm.ev)
+		}
+	})
+	p.pending = pm
+	p.mu.Unlock()
+	if prev != nil {
+		p.emit(*prev)
+	}
+}
+
+// to 为 MOVED_TO 找配对的 MOVED_FROM，配上时合并成一个 RENAME 事件
+func (p *movePairer) to(ev model.FileEvent) model.FileEvent {
+	p.mu.Lock()
+	pm := p.pending
+	if pm == nil || pm.ev.PID != ev.PID || ev.TimeStamp.Sub(pm.ev.TimeStamp) > moveWindow {
+		p.mu.Unlock()
+		return ev
+	}
+	from := p.take()
+	p.mu.Unlock()
+
+	ev.Operation = opRename
+	ev.OldPath = from.FilePath
+	return ev
+}
+
+// take 取出暂存的 MOVED_FROM 并停止计时，调用方持有锁
+func (p *movePairer) take() *model.FileEvent {
+	if p.pending == nil {
+		return nil
+	}
+	p.pending.timer.Stop()
+	ev := p.pending.ev
+	p.pending = nil
+	return &ev
+}
@@ -0,0 +1,346 @@
+package policy
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/Hara602/usbSentry/internal/model"
+)
+
+// 规则动作
+const (
+	ActionAllow = "allow"
+	ActionDeny  = "deny"
+)
+
+// 权限请求的操作类型
+const (
+	OpOpen  = "open"  // FAN_OPEN_PERM (只读打开，或无法判断打开方式)
+	OpWrite = "write" // FAN_OPEN_PERM 且带写意图 (O_WRONLY/O_RDWR/O_CREAT/O_TRUNC)
+	OpExec  = "exec"  // FAN_OPEN_EXEC_PERM
+)
+
+// 只读设备的额外执行方式 (拒绝写打开始终生效)
+const (
+	ReadOnlyDenyWrite = "deny-write" // 仅在 fanotify 层拒绝写打开
+	ReadOnlyRemount   = "remount"    // 同时把文件系统重新挂载为 ro
+	ReadOnlyBlockDev  = "blockdev"   // 同时把块设备设为只读 (BLKROSET) 并重新挂载
+)
+
+// Request 一次权限请求的上下文
+type Request struct {
+	Op       string
+	Path     string
+	PID      int32
+	ProcName string // /proc/<pid>/comm
+	Exe      string // /proc/<pid>/exe
+	Device   model.Device
+
+	// 以下回调按需读取文件内容，只在 noexec 需要时才调用
+	Hash  func() (string, error) // 文件 SHA-256 (hex)
+	IsELF func() bool            // 文件头是否为 ELF
+}
+
+// Rule 一条文件访问策略，所有非空字段都匹配才算命中
+type Rule struct {
+	Name    string   `json:"name"`
+	Action  string   `json:"action"`            // allow / deny
+	Ops     []string `json:"ops,omitempty"`     // open / write / exec，为空表示全部
+	Vid     string   `json:"vid,omitempty"`     // 设备 VID
+	Pid     string   `json:"pid,omitempty"`     // 设备 PID
+	Serial  string   `json:"serial,omitempty"`  // 设备序列号
+	Process string   `json:"process,omitempty"` // 进程名 glob，如 "python*"
+	Exe     string   `json:"exe,omitempty"`     // 可执行文件路径 glob
+	Path    string   `json:"path,omitempty"`    // 文件路径 glob，以 "/**" 结尾表示整棵子树
+	Ext     []string `json:"ext,omitempty"`     // 文件后缀，不带点，忽略大小写
+}
+
+// Decision 裁决结果
+type Decision struct {
+	Verdict string // model.VerdictAllow / model.VerdictDeny
+	Rule    string // 命中的规则名，使用默认动作时为空
+	Reason  string
+}
+
+// DeviceMatch 按设备身份匹配，空字段表示任意
+type DeviceMatch struct {
+	Vid    string `json:"vid,omitempty"`
+	Pid    string `json:"pid,omitempty"`
+	Serial string `json:"serial,omitempty"`
+}
+
+// NoExec 禁止执行 U 盘上的程序，先于普通规则检查
+type NoExec struct {
+	Enabled      bool          `json:"enabled"`
+	Libraries    bool          `json:"libraries,omitempty"`     // 同时拦截普通 open 的 ELF 文件 (ld.so / dlopen 加载的共享库)
+	AllowDevices []DeviceMatch `json:"allow_devices,omitempty"` // 例外设备
+	AllowHashes  []string      `json:"allow_hashes,omitempty"`  // 例外文件 (SHA-256)
+}
+
+// ReadOnly 只读设备 (黑白名单 list_type=readonly) 的执行方式
+// fanotify 拦不住删除、改名和 O_CREAT 新建的空文件，需要彻底只读时用 remount 或 blockdev
+type ReadOnly struct {
+	Enforcement string `json:"enforcement"` // deny-write (默认) / remount / blockdev
+}
+
+// File 策略文件的 JSON 结构
+type File struct {
+	Default  string   `json:"default"` // 未命中任何规则时的动作，默认 allow
+	NoExec   NoExec   `json:"noexec"`
+	ReadOnly ReadOnly `json:"readonly"`
+	Rules    []Rule   `json:"rules"`
+}
+
+// Engine 策略引擎，规则常驻内存 (权限事件在内核里等着回复，不能每次查库)
+type Engine struct {
+	mu            sync.RWMutex
+	defaultAction string
+	noExec        NoExec
+	readOnly      ReadOnly
+	allowHashes   map[string]bool
+	rules         []Rule
+	writeRules    bool // 是否有规则关心写意图 (判断写意图要读 /proc，没人关心时跳过)
+}
+
+// NewEngine 创建一个空引擎：没有规则，全部放行
+func NewEngine() *Engine {
+	return &Engine{defaultAction: ActionAllow}
+}
+
+// LoadFile 从 JSON 文件加载策略，文件不存在时返回空引擎
+func LoadFile(path string) (*Engine, error) {
+	e := NewEngine()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return e, nil
+		}
+		return nil, fmt.Errorf("read policy file failed: %w", err)
+	}
+
+	var pf File
+	if err := json.Unmarshal(data, &pf); err != nil {
+		return nil, fmt.Errorf("parse policy file failed: %w", err)
+	}
+	if err := e.Set(pf); err != nil {
+		return nil, err
+	}
+	return e, nil
+}
+
+// Set 校验并替换全部策略
+func (e *Engine) Set(pf File) error {
+	def := pf.Default
+	if def == "" {
+		def = ActionAllow
+	}
+	if def != ActionAllow && def != ActionDeny {
+		return fmt.Errorf("invalid default action %q", pf.Default)
+	}
+	for i, r := range pf.Rules {
+		if err := r.validate(); err != nil {
+			return fmt.Errorf("rule %d (%s): %w", i, r.Name, err)
+		}
+	}
+	switch pf.ReadOnly.Enforcement {
+	case "":
+		pf.ReadOnly.Enforcement = ReadOnlyDenyWrite
+	case ReadOnlyDenyWrite, ReadOnlyRemount, ReadOnlyBlockDev:
+	default:
+		return fmt.Errorf("readonly: invalid enforcement %q", pf.ReadOnly.Enforcement)
+	}
+	hashes := make(map[string]bool, len(pf.NoExec.AllowHashes))
+	for _, h := range pf.NoExec.AllowHashes {
+		h = strings.ToLower(strings.TrimSpace(h))
+		if len(h) != 64 || strings.Trim(h, "0123456789abcdef") != "" {
+			return fmt.Errorf("noexec: invalid sha256 %q", h)
+		}
+		hashes[h] = true
+	}
+
+	e.mu.Lock()
+	e.defaultAction = def
+	e.noExec = pf.NoExec
+	e.readOnly = pf.ReadOnly
+	e.allowHashes = hashes
+	e.rules = pf.Rules
+	e.writeRules = false
+	for _, r := range pf.Rules {
+		if contains(r.Ops, OpWrite) {
+			e.writeRules = true
+		}
+	}
+	e.mu.Unlock()
+	return nil
+}
+
+func (r Rule) validate() error {
+	if r.Action != ActionAllow && r.Action != ActionDeny {
+		return fmt.Errorf("invalid action %q", r.Action)
+	}
+	for _, op := range r.Ops {
+		if op != OpOpen && op != OpWrite && op != OpExec {
+			return fmt.Errorf("invalid op %q", op)
+		}
+	}
+	// 提前检查 glob 语法，避免运行时每次都匹配失败
+	for _, p := range []string{r.Process, r.Exe, strings.TrimSuffix(r.Path, "/**")} {
+		if _, err := filepath.Match(p, ""); err != nil {
+			return fmt.Errorf("bad pattern %q: %w", p, err)
+		}
+	}
+	return nil
+}
+
+// ReadOnlyEnforcement 返回只读设备的执行方式
+func (e *Engine) ReadOnlyEnforcement() string {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	if e.readOnly.Enforcement == "" {
+		return ReadOnlyDenyWrite
+	}
+	return e.readOnly.Enforcement
+}
+
+// NeedsWriteIntent 判断 dev 上的 open 请求是否需要区分读写
+func (e *Engine) NeedsWriteIntent(dev model.Device) bool {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	return dev.ReadOnly || e.writeRules
+}
+
+// Decide 先检查只读设备和 noexec，再按顺序匹配规则，第一条命中的规则生效
+func (e *Engine) Decide(req Request) Decision {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+
+	if req.Device.ReadOnly && req.Op == OpWrite {
+		return Decision{Verdict: model.VerdictDeny, Rule: "readonly", Reason: "readonly: device is read-only"}
+	}
+
+	if e.denyExec(req) {
+		return Decision{Verdict: model.VerdictDeny, Rule: "noexec", Reason: "noexec: execution from removable media"}
+	}
+
+	for _, r := range e.rules {
+		if r.match(req) {
+			return Decision{Verdict: verdictOf(r.Action), Rule: r.Name, Reason: "matched rule " + r.Name}
+		}
+	}
+	return Decision{Verdict: verdictOf(e.defaultAction), Reason: "default " + e.defaultAction}
+}
+
+// denyExec 判断 noexec 是否拦截本次请求，例外设备和例外哈希放行后继续走普通规则
+func (e *Engine) denyExec(req Request) bool {
+	if !e.noExec.Enabled {
+		return false
+	}
+	isExec := req.Op == OpExec
+	if !isExec && e.noExec.Libraries && req.Op == OpOpen && req.IsELF != nil {
+		isExec = req.IsELF()
+	}
+	if !isExec {
+		return false
+	}
+
+	for _, m := range e.noExec.AllowDevices {
+		if m.match(req.Device) {
+			return false
+		}
+	}
+	if len(e.allowHashes) > 0 && req.Hash != nil {
+		if h, err := req.Hash(); err == nil && e.allowHashes[h] {
+			return false
+		}
+	}
+	return true
+}
+
+func (m DeviceMatch) match(dev model.Device) bool {
+	if m.Vid == "" && m.Pid == "" && m.Serial == "" {
+		return false
+	}
+	return (m.Vid == "" || strings.EqualFold(m.Vid, dev.Vid)) &&
+		(m.Pid == "" || strings.EqualFold(m.Pid, dev.Pid)) &&
+		(m.Serial == "" || m.Serial == dev.Serial)
+}
+
+func (r Rule) match(req Request) bool {
+	if len(r.Ops) > 0 && !contains(r.Ops, req.Op) {
+		return false
+	}
+	if r.Vid != "" && !strings.EqualFold(r.Vid, req.Device.Vid) {
+		return false
+	}
+	if r.Pid != "" && !strings.EqualFold(r.Pid, req.Device.Pid) {
+		return false
+	}
+	if r.Serial != "" && r.Serial != req.Device.Serial {
+		return false
+	}
+	if r.Process != "" && !globMatch(r.Process, req.ProcName) {
+		return false
+	}
+	if r.Exe != "" && !globMatch(r.Exe, req.Exe) {
+		return false
+	}
+	if r.Path != "" && !pathMatch(r.Path, req.Path) {
+		return false
+	}
+	if len(r.Ext) > 0 {
+		ext := strings.ToLower(strings.TrimPrefix(filepath.Ext(req.Path), "."))
+		matched := false
+		for _, want := range r.Ext {
+			if strings.ToLower(strings.TrimPrefix(want, ".")) == ext {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			return false
+		}
+	}
+	return true
+}
+
+// pathMatch 在 filepath.Match 的基础上支持 "/**" 后缀匹配整棵子树
+func pathMatch(pattern, path string) bool {
+	if prefix, ok := strings.CutSuffix(pattern, "/**"); ok {
+		// 逐级向上找，任意一级祖先目录匹配前缀即可
+		for dir := filepath.Dir(path); ; dir = filepath.Dir(dir) {
+			if globMatch(prefix, dir) {
+				return true
+			}
+			if dir == "/" || dir == "." {
+				return false
+			}
+		}
+	}
+	return globMatch(pattern, path)
+}
+
+func globMatch(pattern, s string) bool {
+	ok, _ := filepath.Match(pattern, s)
+	return ok
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+func verdictOf(action string) string {
+	if action == ActionDeny {
+		return model.VerdictDeny
+	}
+	return model.VerdictAllow
+}
@@ -0,0 +1,275 @@
+package quarantine
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/Hara602/usbSentry/internal/model"
+)
+
+// Item 一个被隔离的文件
+// 隔离区里每个 Item 对应两个文件: <id>.bin (内容) 和 <id>.json (元数据)
+type Item struct {
+	ID            string       `json:"id"`
+	OriginalPath  string       `json:"original_path"`
+	SHA256        string       `json:"sha256"`
+	Size          int64        `json:"size"`
+	Device        model.Device `json:"device"`
+	PID           int32        `json:"pid"`
+	ProcName      string       `json:"process"`
+	RiskLevel     string       `json:"risk_level"`
+	RealExt       string       `json:"real_ext"`
+	DeclaredExt   string       `json:"declared_ext"`
+	Message       string       `json:"message"`
+	Removed       bool         `json:"removed"` // 原文件是否已从 U 盘删除
+	QuarantinedAt time.Time    `json:"quarantined_at"`
+}
+
+// Store 本地隔离区 (目录权限 0700，只有 root 能访问)
+type Store struct {
+	dir string
+}
+
+// Open 打开 (必要时创建) 隔离区目录
+func Open(dir string) (*Store, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, fmt.Errorf("create quarantine dir failed: %w", err)
+	}
+	// MkdirAll 不会修改已存在目录的权限
+	if err := os.Chmod(dir, 0700); err != nil {
+		return nil, fmt.Errorf("chmod quarantine dir failed: %w", err)
+	}
+	return &Store{dir: dir}, nil
+}
+
+func (s *Store) Dir() string { return s.dir }
+
+func (s *Store) blobPath(id string) string { return filepath.Join(s.dir, id+".bin") }
+func (s *Store) metaPath(id string) string { return filepath.Join(s.dir, id+".json") }
+
+// Add 把 path 拷贝进隔离区，removeOriginal 为 true 时随后删除原文件
+// item 中由调用方填写来源信息 (设备、进程、风险等级)，ID/哈希/大小由这里生成
+// 内容和元数据都落盘后才删除原文件；删除之后出错时隔离文件保留，同时返回 item 和错误
+func (s *Store) Add(path string, item Item, removeOriginal bool) (*Item, error) {
+	src, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("open file failed: %w", err)
+	}
+	defer src.Close()
+
+	// 先写临时文件，算出哈希后再改名，避免出现半截的隔离文件
+	tmp, err := os.CreateTemp(s.dir, ".incoming-*")
+	if err != nil {
+		return nil, fmt.Errorf("create temp file failed: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	hasher := sha256.New()
+	size, err := io.Copy(io.MultiWriter(tmp, hasher), src)
+	if err == nil {
+		err = tmp.Sync()
+	}
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return nil, fmt.Errorf("copy file failed: %w", err)
+	}
+
+	item.SHA256 = hex.EncodeToString(hasher.Sum(nil))
+	item.Size = size
+	item.OriginalPath = path
+	item.QuarantinedAt = time.Now()
+	// 同一秒内可能隔离同一内容的多个副本 (如 cp -r 复制同一个文件到多处)，加随机后缀，否则后一个会覆盖前一个
+	var suffix [4]byte
+	if _, err := rand.Read(suffix[:]); err != nil {
+		return nil, err
+	}
+	item.ID = fmt.Sprintf("%s-%s-%s", item.QuarantinedAt.Format("20060102T150405"), item.SHA256[:12], hex.EncodeToString(suffix[:]))
+
+	if err := os.Chmod(tmp.Name(), 0400); err != nil {
+		return nil, err
+	}
+	if err := os.Rename(tmp.Name(), s.blobPath(item.ID)); err != nil {
+		return nil, fmt.Errorf("store file failed: %w", err)
+	}
+
+	// 此时原文件还在，元数据写不进去就撤销隔离
+	if err := s.writeMeta(&item); err != nil {
+		os.Remove(s.blobPath(item.ID))
+		return nil, err
+	}
+	if !removeOriginal {
+		return &item, nil
+	}
+
+	src.Close()
+	if err := os.Remove(path); err != nil {
+		// 删不掉 (如 U 盘只读) 时原文件留在原处，元数据中 removed 为 false
+		return &item, nil
+	}
+	// 原文件已经删除，隔离文件是唯一的副本，之后无论如何都不能再删
+	item.Removed = true
+	if err := s.writeMeta(&item); err != nil {
+		return &item, fmt.Errorf("original removed but updating metadata failed: %w", err)
+	}
+	return &item, nil
+}
+
+// writeMeta 先写临时文件并 fsync，再改名覆盖，保证元数据不会只写一半
+func (s *Store) writeMeta(item *Item) error {
+	data, err := json.MarshalIndent(item, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(s.dir, ".meta-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	_, err = tmp.Write(data)
+	if err == nil {
+		err = tmp.Chmod(0600)
+	}
+	if err == nil {
+		err = tmp.Sync()
+	}
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return fmt.Errorf("write metadata failed: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), s.metaPath(item.ID)); err != nil {
+		return fmt.Errorf("store metadata failed: %w", err)
+	}
+	return s.syncDir()
+}
+
+// syncDir 让改名 (新的隔离文件和元数据) 也落盘
+func (s *Store) syncDir() error {
+	dir, err := os.Open(s.dir)
+	if err != nil {
+		return err
+	}
+	defer dir.Close()
+	return dir.Sync()
+}
+
+// List 列出隔离区中的全部文件，按隔离时间排序
+func (s *Store) List() ([]Item, error) {
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		return nil, err
+	}
+	var items []Item
+	for _, e := range entries {
+		id, ok := strings.CutSuffix(e.Name(), ".json")
+		if !ok {
+			continue
+		}
+		item, err := s.Get(id)
+		if err != nil {
+			continue
+		}
+		items = append(items, *item)
+	}
+	sort.Slice(items, func(i, j int) bool { return items[i].QuarantinedAt.Before(items[j].QuarantinedAt) })
+	return items, nil
+}
+
+// Get 读取单个隔离文件的元数据
+func (s *Store) Get(id string) (*Item, error) {
+	if id == "" || strings.ContainsAny(id, `/\`) {
+		return nil, fmt.Errorf("invalid id %q", id)
+	}
+	data, err := os.ReadFile(s.metaPath(id))
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, fmt.Errorf("quarantine item %s not found", id)
+		}
+		return nil, err
+	}
+	var item Item
+	if err := json.Unmarshal(data, &item); err != nil {
+		return nil, fmt.Errorf("corrupt metadata %s: %w", id, err)
+	}
+	return &item, nil
+}
+
+// Restore 把隔离文件还原到 dest (为空时还原到原路径)，成功后从隔离区移除
+// 目标已存在时拒绝覆盖，除非 overwrite 为 true
+func (s *Store) Restore(id, dest string, overwrite bool) (string, error) {
+	item, err := s.Get(id)
+	if err != nil {
+		return "", err
+	}
+	if dest == "" {
+		dest = item.OriginalPath
+	}
+
+	flags := os.O_WRONLY | os.O_CREATE | os.O_EXCL
+	if overwrite {
+		flags = os.O_WRONLY | os.O_CREATE | os.O_TRUNC
+	}
+	dst, err := os.OpenFile(dest, flags, 0644)
+	if err != nil {
+		return "", fmt.Errorf("create %s failed: %w", dest, err)
+	}
+
+	src, err := os.Open(s.blobPath(id))
+	if err != nil {
+		dst.Close()
+		return "", err
+	}
+	defer src.Close()
+
+	_, err = io.Copy(dst, src)
+	if cerr := dst.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return "", fmt.Errorf("restore %s failed: %w", dest, err)
+	}
+
+	return dest, s.Purge(id)
+}
+
+// Purge 从隔离区彻底删除
+func (s *Store) Purge(id string) error {
+	if _, err := s.Get(id); err != nil {
+		return err
+	}
+	if err := os.Remove(s.blobPath(id)); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	return os.Remove(s.metaPath(id))
+}
+
+// PurgeOlderThan 删除隔离时间早于 cutoff 的文件，返回删除数量
+func (s *Store) PurgeOlderThan(cutoff time.Time) (int, error) {
+	items, err := s.List()
+	if err != nil {
+		return 0, err
+	}
+	n := 0
+	for _, item := range items {
+		if item.QuarantinedAt.Before(cutoff) {
+			if err := s.Purge(item.ID); err != nil {
+				return n, err
+			}
+			n++
+		}
+	}
+	return n, nil
+}
@@ -0,0 +1,82 @@
+package registry
+
+import (
+	"sort"
+	"sync"
+
+	"github.com/Hara602/usbSentry/internal/model"
+)
+
+// Registry 当前已连接并挂载的 U 盘分区
+// 以分区设备节点 (/dev/sdb1) 为键，同时按 USB 设备的 sysfs 路径分组，
+// 这样无论内核先发分区的 remove 还是整个 USB 设备的 remove，都能找回完整的设备信息
+type Registry struct {
+	mu         sync.RWMutex
+	partitions map[string]model.USBEvent // /dev/sdb1 -> 挂载时的 add 事件
+}
+
+func New() *Registry {
+	return &Registry{partitions: make(map[string]model.USBEvent)}
+}
+
+// Add 记录一个已挂载的分区 (同一分区重复 add 时覆盖)
+func (r *Registry) Add(ev model.USBEvent) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.partitions[ev.DevicePath] = ev
+}
+
+// Remove 移除分区并返回它的 add 事件，不存在返回 false
+func (r *Registry) Remove(devicePath string) (model.USBEvent, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	ev, ok := r.partitions[devicePath]
+	delete(r.partitions, devicePath)
+	return ev, ok
+}
+
+// RemoveDevice 移除某个 USB 设备 (sysfs 路径) 下的所有分区并返回
+func (r *Registry) RemoveDevice(sysPath string) []model.USBEvent {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var out []model.USBEvent
+	for dev, ev := range r.partitions {
+		if ev.SysPath == sysPath {
+			out = append(out, ev)
+			delete(r.partitions, dev)
+		}
+	}
+	sortEvents(out)
+	return out
+}
+
+// Get 按分区设备节点查询
+func (r *Registry) Get(devicePath string) (model.USBEvent, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	ev, ok := r.partitions[devicePath]
+	return ev, ok
+}
+
+// List 当前所有已连接的分区，按设备节点排序
+func (r *Registry) List() []model.USBEvent {
+	r.mu.RLock()
+	out := make([]model.USBEvent, 0, len(r.partitions))
+	for _, ev := range r.partitions {
+		out = append(out, ev)
+	}
+	r.mu.RUnlock()
+	sortEvents(out)
+	return out
+}
+
+// Len 当前已连接的分区数
+func (r *Registry) Len() int {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return len(r.partitions)
+}
+
+func sortEvents(evs []model.USBEvent) {
+	sort.Slice(evs, func(i, j int) bool { return evs[i].DevicePath < evs[j].DevicePath })
+}
@@ -0,0 +1,165 @@
+package session
+
+import (
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Hara602/usbSentry/internal/model"
+)
+
+// 会话结束原因
+const (
+	EndRemoved      = "removed"
+	EndAgentStopped = "agent_stopped"
+)
+
+// Tracker 按会话 ID 累计文件操作，设备拔出时生成汇总报告
+type Tracker struct {
+	mu       sync.Mutex
+	sessions map[string]*state // session id -> 统计
+}
+
+type state struct {
+	device    model.DeviceContext
+	inserted  time.Time
+	created   map[string]bool
+	written   map[string]int64 // 路径 -> 最后一次写完时的大小
+	deleted   map[string]bool
+	renamed   map[string]bool
+	denied    int
+	processes map[string]*model.ProcessStat
+}
+
+func NewTracker() *Tracker {
+	return &Tracker{sessions: make(map[string]*state)}
+}
+
+// Start 设备挂载，开始一个会话
+func (t *Tracker) Start(dev model.DeviceContext, at time.Time) {
+	if dev.SessionID == "" {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.sessions[dev.SessionID] = &state{
+		device:    dev,
+		inserted:  at,
+		created:   make(map[string]bool),
+		written:   make(map[string]int64),
+		deleted:   make(map[string]bool),
+		renamed:   make(map[string]bool),
+		processes: make(map[string]*model.ProcessStat),
+	}
+}
+
+// Observe 记录一个文件事件，不属于任何进行中会话的事件忽略
+func (t *Tracker) Observe(ev model.FileEvent) {
+	if ev.Device == nil {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	s := t.sessions[ev.Device.SessionID]
+	if s == nil {
+		return
+	}
+
+	op := ev.Operation
+	switch {
+	case strings.Contains(op, "CREATE"):
+		s.created[ev.FilePath] = true
+	case strings.Contains(op, "DELETE"):
+		s.deleted[ev.FilePath] = true
+	case strings.Contains(op, "RENAME"), strings.Contains(op, "MOVED_TO"):
+		s.renamed[ev.FilePath] = true
+	}
+	if strings.Contains(op, "CLOSE_WRITE") {
+		s.written[ev.FilePath] = ev.Size
+	}
+	if ev.Verdict == model.VerdictDeny || ev.Verdict == model.VerdictWouldDeny {
+		s.denied++
+	}
+
+	p := s.processes[ev.ProcName]
+	if p == nil {
+		p = &model.ProcessStat{Name: ev.ProcName}
+		s.processes[ev.ProcName] = p
+	}
+	p.Events++
+	if !containsPID(p.PIDs, ev.PID) {
+		p.PIDs = append(p.PIDs, ev.PID)
+	}
+}
+
+// End 结束会话并返回汇总，会话不存在时返回 nil
+func (t *Tracker) End(sessionID string, at time.Time, reason string) *model.SessionSummary {
+	t.mu.Lock()
+	s := t.sessions[sessionID]
+	delete(t.sessions, sessionID)
+	t.mu.Unlock()
+	if s == nil {
+		return nil
+	}
+	return s.summary(sessionID, at, reason)
+}
+
+// EndAll 结束所有进行中的会话 (Agent 退出时调用)
+func (t *Tracker) EndAll(at time.Time, reason string) []*model.SessionSummary {
+	t.mu.Lock()
+	ids := make([]string, 0, len(t.sessions))
+	for id := range t.sessions {
+		ids = append(ids, id)
+	}
+	t.mu.Unlock()
+
+	var out []*model.SessionSummary
+	for _, id := range ids {
+		if sum := t.End(id, at, reason); sum != nil {
+			out = append(out, sum)
+		}
+	}
+	return out
+}
+
+func (s *state) summary(id string, at time.Time, reason string) *model.SessionSummary {
+	sum := &model.SessionSummary{
+		SessionID:       id,
+		Device:          s.device,
+		InsertedAt:      s.inserted,
+		RemovedAt:       at,
+		DurationSeconds: at.Sub(s.inserted).Seconds(),
+		EndReason:       reason,
+		FilesCreated:    len(s.created),
+		FilesWritten:    len(s.written),
+		FilesDeleted:    len(s.deleted),
+		FilesRenamed:    len(s.renamed),
+		Denied:          s.denied,
+		Processes:       []model.ProcessStat{},
+	}
+	for _, size := range s.written {
+		sum.WrittenFilesSize += size
+	}
+	for _, p := range s.processes {
+		sum.Processes = append(sum.Processes, *p)
+	}
+	// 操作最多的进程排在前面
+	sort.Slice(sum.Processes, func(i, j int) bool {
+		a, b := sum.Processes[i], sum.Processes[j]
+		if a.Events != b.Events {
+			return a.Events > b.Events
+		}
+		return a.Name < b.Name
+	})
+	return sum
+}
+
+func containsPID(pids []int32, pid int32) bool {
+	for _, p := range pids {
+		if p == pid {
+			return true
+		}
+	}
+	return false
+}
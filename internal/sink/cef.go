@@ -0,0 +1,153 @@
+package sink
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/Hara602/usbSentry/internal/model"
+)
+
+// field CEF/LEEF 扩展字段，按顺序输出，值为空时省略
+type field struct {
+	key, value string
+}
+
+// siemFields CEF/LEEF 共用的扩展字段，键名使用 CEF 的标准字段和 cs1..cs6 自定义字段
+func siemFields(ev model.Event) []field {
+	fields := []field{
+		{"rt", strconv.FormatInt(ev.Time.UnixMilli(), 10)},
+		{"dvchost", ev.Host},
+	}
+	if dev := ev.Device(); dev != nil {
+		fields = append(fields, custom(1, "usbVendorId", dev.Vid)...)
+		fields = append(fields, custom(2, "usbProductId", dev.Pid)...)
+		fields = append(fields, custom(3, "usbSerial", dev.Serial)...)
+		fields = append(fields, custom(4, "usbProduct", dev.Product)...)
+		fields = append(fields, custom(5, "sessionId", dev.SessionID)...)
+		fields = append(fields, field{"deviceExternalId", dev.DevPath})
+	}
+	switch {
+	case ev.USB != nil:
+		fields = append(fields, field{"act", ev.USB.Action}, field{"filePath", ev.USB.MountPoint})
+	case ev.File != nil:
+		e := ev.File
+		fields = append(fields,
+			field{"act", e.Verdict},
+			field{"reason", e.Reason},
+			field{"spid", pidString(e.PID)},
+			field{"sproc", e.ProcName},
+			field{"filePath", e.FilePath},
+			field{"oldFilePath", e.OldPath},
+		)
+		if p := e.Process; p != nil && !p.Exited {
+			// suser / suid 取 effective uid；cs6 在文件事件中放可执行文件路径
+			fields = append(fields, custom(6, "processExe", p.Exe)...)
+			fields = append(fields,
+				field{"suid", strconv.FormatUint(uint64(p.EUID), 10)},
+				field{"suser", p.EUser},
+			)
+		}
+		if e.Size > 0 {
+			fields = append(fields, field{"fsize", strconv.FormatInt(e.Size, 10)})
+		}
+	case ev.Analysis != nil:
+		e := ev.Analysis
+		fields = append(fields, custom(6, "quarantineId", e.QuarantineID)...)
+		fields = append(fields,
+			field{"spid", pidString(e.PID)},
+			field{"sproc", e.ProcName},
+			field{"filePath", e.FilePath},
+			field{"msg", e.Message},
+		)
+	case ev.Session != nil:
+		e := ev.Session
+		fields = append(fields,
+			field{"start", strconv.FormatInt(e.InsertedAt.UnixMilli(), 10)},
+			field{"end", strconv.FormatInt(e.RemovedAt.UnixMilli(), 10)},
+			field{"reason", e.EndReason},
+			field{"msg", fmt.Sprintf("created=%d written=%d deleted=%d renamed=%d size=%d denied=%d",
+				e.FilesCreated, e.FilesWritten, e.FilesDeleted, e.FilesRenamed, e.WrittenFilesSize, e.Denied)},
+		)
+	}
+	return fields
+}
+
+// custom CEF 自定义字符串字段 csN 及其标签，值为空时连标签一起省略
+func custom(n int, label, value string) []field {
+	if value == "" {
+		return nil
+	}
+	return []field{{fmt.Sprintf("cs%dLabel", n), label}, {fmt.Sprintf("cs%d", n), value}}
+}
+
+func pidString(pid int32) string {
+	if pid == 0 {
+		return ""
+	}
+	return strconv.Itoa(int(pid))
+}
+
+// toCEF ArcSight Common Event Format:
+// CEF:0|Vendor|Product|Version|SignatureID|Name|Severity|key=value key=value ...
+func toCEF(ev model.Event) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "CEF:0|%s|%s|%s|%s|%s|%d|",
+		cefHeader.Replace(vendorName), cefHeader.Replace(productName), cefHeader.Replace(productVersion),
+		cefHeader.Replace(signatureID(ev)), cefHeader.Replace(eventName(ev)), severity(ev))
+	sep := ""
+	for _, f := range siemFields(ev) {
+		if f.value == "" {
+			continue
+		}
+		b.WriteString(sep + f.key + "=" + cefValue.Replace(f.value))
+		sep = " "
+	}
+	return b.String()
+}
+
+var (
+	cefHeader = strings.NewReplacer(`\`, `\\`, "|", `\|`, "\n", " ", "\r", " ")
+	cefValue  = strings.NewReplacer(`\`, `\\`, "=", `\=`, "\n", `\n`, "\r", `\r`)
+)
+
+// toLEEF IBM QRadar Log Event Extended Format 1.0，属性之间用 tab 分隔:
+// LEEF:1.0|Vendor|Product|Version|EventID|key=value<tab>key=value ...
+func toLEEF(ev model.Event) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "LEEF:1.0|%s|%s|%s|%s|",
+		leefHeader.Replace(vendorName), leefHeader.Replace(productName), leefHeader.Replace(productVersion),
+		leefHeader.Replace(signatureID(ev)))
+	fields := []field{
+		{"devTime", ev.Time.UTC().Format(leefTimeLayout)},
+		{"devTimeFormat", leefTimeFormat},
+		{"sev", strconv.Itoa(max(severity(ev), 1))},
+		{"cat", ev.Type},
+	}
+	for _, f := range siemFields(ev) {
+		// 时间已经在 devTime 中，其余键名与 CEF 相同，QRadar 可以直接映射
+		if f.key != "rt" {
+			fields = append(fields, f)
+		}
+	}
+	sep := ""
+	for _, f := range fields {
+		if f.value == "" {
+			continue
+		}
+		b.WriteString(sep + f.key + "=" + leefValue.Replace(f.value))
+		sep = "\t"
+	}
+	return b.String()
+}
+
+// devTime 使用的格式 (Go layout 与 LEEF 中声明的 Java 格式对应)
+const (
+	leefTimeLayout = "Jan 02 2006 15:04:05.000 MST"
+	leefTimeFormat = "MMM dd yyyy HH:mm:ss.SSS z"
+)
+
+var (
+	leefHeader = strings.NewReplacer("|", " ", "\n", " ", "\r", " ")
+	leefValue  = strings.NewReplacer("\t", " ", "\n", " ", "\r", " ")
+)
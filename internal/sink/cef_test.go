@@ -0,0 +1,93 @@
+package sink
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Hara602/usbSentry/internal/model"
+)
+
+func TestCEFEscaping(t *testing.T) {
+	tests := []struct {
+		name       string
+		in         string
+		wantHeader string
+		wantValue  string
+	}{
+		{"plain", "report.docx", "report.docx", "report.docx"},
+		{"pipe", "a|b", `a\|b`, "a|b"},
+		{"equals", "a=b", "a=b", `a\=b`},
+		{"backslash", `C:\tmp`, `C:\\tmp`, `C:\\tmp`},
+		{"backslash before pipe", `\|`, `\\\|`, `\\|`},
+		{"newlines", "a\nb\rc", "a b c", `a\nb\rc`},
+		{"tab kept", "a\tb", "a\tb", "a\tb"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := cefHeader.Replace(tt.in); got != tt.wantHeader {
+				t.Errorf("cefHeader(%q) = %q, want %q", tt.in, got, tt.wantHeader)
+			}
+			if got := cefValue.Replace(tt.in); got != tt.wantValue {
+				t.Errorf("cefValue(%q) = %q, want %q", tt.in, got, tt.wantValue)
+			}
+		})
+	}
+}
+
+func TestLEEFEscaping(t *testing.T) {
+	tests := []struct {
+		name       string
+		in         string
+		wantHeader string
+		wantValue  string
+	}{
+		{"plain", "report.docx", "report.docx", "report.docx"},
+		{"pipe", "a|b", "a b", "a|b"},
+		{"equals kept", "a=b", "a=b", "a=b"},
+		{"tab", "a\tb", "a\tb", "a b"},
+		{"newlines", "a\nb\rc", "a b c", "a b c"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := leefHeader.Replace(tt.in); got != tt.wantHeader {
+				t.Errorf("leefHeader(%q) = %q, want %q", tt.in, got, tt.wantHeader)
+			}
+			if got := leefValue.Replace(tt.in); got != tt.wantValue {
+				t.Errorf("leefValue(%q) = %q, want %q", tt.in, got, tt.wantValue)
+			}
+		})
+	}
+}
+
+// 路径中的分隔符不能破坏记录结构
+func TestSIEMRecordsEscapeFields(t *testing.T) {
+	ev := model.Event{
+		Type: model.EventFile,
+		Time: time.Date(2026, 10, 1, 8, 0, 0, 0, time.UTC),
+		Host: "ws01",
+		File: &model.FileEvent{
+			Operation: "CLOSE_WRITE",
+			Verdict:   model.VerdictAllow,
+			FilePath:  "/media/usb/a=b\tc|d\n.txt",
+			ProcName:  "cp",
+			PID:       42,
+		},
+	}
+
+	cef := toCEF(ev)
+	if strings.ContainsAny(cef, "\n\r") {
+		t.Errorf("CEF record contains a line break: %q", cef)
+	}
+	if want := `filePath=/media/usb/a\=b` + "\t" + `c|d\n.txt`; !strings.Contains(cef, want) {
+		t.Errorf("CEF record %q does not contain %q", cef, want)
+	}
+
+	leef := toLEEF(ev)
+	if strings.ContainsAny(leef, "\n\r") {
+		t.Errorf("LEEF record contains a line break: %q", leef)
+	}
+	if want := "\tfilePath=/media/usb/a=b c|d .txt"; !strings.Contains(leef, want) {
+		t.Errorf("LEEF record %q does not contain %q", leef, want)
+	}
+}
@@ -0,0 +1,308 @@
+package sink
+
+import (
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Hara602/usbSentry/internal/model"
+)
+
+const ecsVersion = "8.11.0"
+
+// ecsDoc Elastic Common Schema 文档，ECS 没有的字段 (vid/pid、会话等) 放在 usbsentry 下
+type ecsDoc struct {
+	Timestamp time.Time    `json:"@timestamp"`
+	Message   string       `json:"message,omitempty"`
+	ECS       ecsMeta      `json:"ecs"`
+	Event     ecsEvent     `json:"event"`
+	Host      ecsHost      `json:"host"`
+	Observer  ecsObserver  `json:"observer"`
+	Process   *ecsProcess  `json:"process,omitempty"`
+	User      *ecsUser     `json:"user,omitempty"`
+	Container *ecsID       `json:"container,omitempty"`
+	File      *ecsFile     `json:"file,omitempty"`
+	Device    *ecsDevice   `json:"device,omitempty"`
+	Rule      *ecsRule     `json:"rule,omitempty"`
+	USBSentry ecsUSBSentry `json:"usbsentry"`
+}
+
+type ecsMeta struct {
+	Version string `json:"version"`
+}
+
+type ecsEvent struct {
+	Kind     string   `json:"kind"`
+	Category []string `json:"category"`
+	Type     []string `json:"type"`
+	Action   string   `json:"action"`
+	Outcome  string   `json:"outcome,omitempty"`
+	Reason   string   `json:"reason,omitempty"`
+	Severity int      `json:"severity"`
+	Module   string   `json:"module"`
+	Dataset  string   `json:"dataset"`
+	Start    string   `json:"start,omitempty"`
+	End      string   `json:"end,omitempty"`
+	Duration int64    `json:"duration,omitempty"` // 纳秒
+}
+
+type ecsHost struct {
+	Hostname string `json:"hostname,omitempty"`
+}
+
+type ecsObserver struct {
+	Vendor  string `json:"vendor"`
+	Product string `json:"product"`
+	Type    string `json:"type"`
+}
+
+type ecsProcess struct {
+	PID         int32             `json:"pid,omitempty"`
+	Name        string            `json:"name,omitempty"`
+	Executable  string            `json:"executable,omitempty"`
+	Args        []string          `json:"args,omitempty"`
+	CommandLine string            `json:"command_line,omitempty"`
+	Start       string            `json:"start,omitempty"`
+	Hash        *ecsHash          `json:"hash,omitempty"`
+	Parent      *ecsProcessParent `json:"parent,omitempty"`
+	User        *ecsUser          `json:"user,omitempty"`      // effective
+	RealUser    *ecsUser          `json:"real_user,omitempty"` // real
+	TTY         *ecsTTY           `json:"tty,omitempty"`
+}
+
+type ecsProcessParent struct {
+	PID        int32  `json:"pid,omitempty"`
+	Name       string `json:"name,omitempty"`
+	Executable string `json:"executable,omitempty"`
+}
+
+type ecsHash struct {
+	SHA256 string `json:"sha256"`
+}
+
+type ecsUser struct {
+	ID   string `json:"id"`
+	Name string `json:"name,omitempty"`
+}
+
+type ecsTTY struct {
+	Name string `json:"name"` // ECS 只定义了 char_device，终端名放这里方便检索
+}
+
+type ecsID struct {
+	ID string `json:"id"`
+}
+
+type ecsFile struct {
+	Path      string `json:"path"`
+	Name      string `json:"name,omitempty"`
+	Directory string `json:"directory,omitempty"`
+	Extension string `json:"extension,omitempty"`
+	Size      int64  `json:"size,omitempty"`
+}
+
+type ecsDevice struct {
+	ID           string         `json:"id,omitempty"` // 序列号
+	Manufacturer string         `json:"manufacturer,omitempty"`
+	Model        ecsDeviceModel `json:"model"`
+}
+
+type ecsDeviceModel struct {
+	Identifier string `json:"identifier,omitempty"` // vid:pid
+	Name       string `json:"name,omitempty"`
+}
+
+type ecsRule struct {
+	Name string `json:"name"`
+}
+
+type ecsUSBSentry struct {
+	Type         string                `json:"type"`
+	Vid          string                `json:"vid,omitempty"`
+	Pid          string                `json:"pid,omitempty"`
+	DevicePath   string                `json:"device_path,omitempty"`
+	MountPoint   string                `json:"mount_point,omitempty"`
+	SessionID    string                `json:"session_id,omitempty"`
+	Verdict      string                `json:"verdict,omitempty"`
+	OldPath      string                `json:"old_path,omitempty"` // 改名前的路径 (ECS 没有对应字段)
+	Process      *ecsProcessExtra      `json:"process,omitempty"`
+	QuarantineID string                `json:"quarantine_id,omitempty"`
+	Session      *model.SessionSummary `json:"session,omitempty"`
+}
+
+// ecsProcessExtra ECS 没有对应字段的进程信息
+type ecsProcessExtra struct {
+	Ancestors   []model.ProcessRef `json:"ancestors,omitempty"`
+	LoginUID    *uint32            `json:"loginuid,omitempty"`
+	LoginUser   string             `json:"login_user,omitempty"`
+	AuditSessID *uint32            `json:"audit_session,omitempty"`
+	Cgroup      string             `json:"cgroup,omitempty"`
+}
+
+func toECS(ev model.Event) ecsDoc {
+	doc := ecsDoc{
+		Timestamp: ev.Time.UTC(),
+		Message:   eventName(ev),
+		ECS:       ecsMeta{Version: ecsVersion},
+		Event: ecsEvent{
+			Kind:     "event",
+			Severity: severity(ev) * 10,
+			Module:   "usbsentry",
+			Dataset:  "usbsentry." + ev.Type,
+		},
+		Host:      ecsHost{Hostname: ev.Host},
+		Observer:  ecsObserver{Vendor: vendorName, Product: productName, Type: "agent"},
+		USBSentry: ecsUSBSentry{Type: ev.Type},
+	}
+
+	if dev := ev.Device(); dev != nil {
+		doc.Device = &ecsDevice{
+			ID:           dev.Serial,
+			Manufacturer: dev.Manufacturer,
+			Model:        ecsDeviceModel{Name: dev.Product},
+		}
+		if dev.Vid != "" || dev.Pid != "" {
+			doc.Device.Model.Identifier = dev.Vid + ":" + dev.Pid
+		}
+		doc.USBSentry.Vid, doc.USBSentry.Pid = dev.Vid, dev.Pid
+		doc.USBSentry.DevicePath, doc.USBSentry.MountPoint = dev.DevPath, dev.MountPoint
+		doc.USBSentry.SessionID = dev.SessionID
+	}
+
+	switch {
+	case ev.USB != nil:
+		doc.Event.Category = []string{"host"}
+		doc.Event.Type = []string{"info"}
+		doc.Event.Action = "usb-" + ev.USB.Action
+
+	case ev.File != nil:
+		e := ev.File
+		doc.Event.Category = []string{"file"}
+		doc.Event.Type = []string{ecsFileType(e.Operation)}
+		// ECS 中 allowed/denied 只属于 intrusion_detection 类别，不能挂在 file 下
+		if t := ecsVerdictType(e.Verdict); t != "" {
+			doc.Event.Category = append(doc.Event.Category, "intrusion_detection")
+			doc.Event.Type = append(doc.Event.Type, t)
+		}
+		doc.Event.Action = ecsAction(e.Operation)
+		doc.Event.Reason = e.Reason
+		doc.USBSentry.Verdict = e.Verdict
+		doc.USBSentry.OldPath = e.OldPath
+		if e.Verdict == model.VerdictDeny {
+			doc.Event.Outcome = "failure"
+		} else {
+			doc.Event.Outcome = "success"
+		}
+		doc.Process = &ecsProcess{PID: e.PID, Name: e.ProcName}
+		if p := e.Process; p != nil && !p.Exited {
+			ecsProcessInfo(&doc, p)
+		}
+		doc.File = ecsFileOf(e.FilePath)
+		doc.File.Size = e.Size
+
+	case ev.Analysis != nil:
+		e := ev.Analysis
+		doc.Event.Kind = "alert"
+		// indicator 属于 threat 类别；info 对 intrusion_detection 和 file 都合法
+		doc.Event.Category = []string{"intrusion_detection"}
+		doc.Event.Type = []string{"info"}
+		doc.Event.Action = e.Analyzer + "-detected"
+		doc.Event.Reason = e.Message
+		doc.Rule = &ecsRule{Name: e.Analyzer}
+		if e.ProcName != "" {
+			doc.Process = &ecsProcess{PID: e.PID, Name: e.ProcName}
+		}
+		if e.FilePath != "" {
+			doc.Event.Category = append(doc.Event.Category, "file")
+			doc.File = ecsFileOf(e.FilePath)
+		}
+		doc.USBSentry.QuarantineID = e.QuarantineID
+
+	case ev.Session != nil:
+		e := ev.Session
+		doc.Event.Category = []string{"session"}
+		doc.Event.Type = []string{"end"}
+		doc.Event.Action = "usb-session-" + e.EndReason
+		doc.Event.Start = e.InsertedAt.UTC().Format(time.RFC3339Nano)
+		doc.Event.End = e.RemovedAt.UTC().Format(time.RFC3339Nano)
+		doc.Event.Duration = int64(e.DurationSeconds * float64(time.Second))
+		doc.USBSentry.Session = e
+	}
+	return doc
+}
+
+func ecsFileOf(path string) *ecsFile {
+	return &ecsFile{
+		Path:      path,
+		Name:      filepath.Base(path),
+		Directory: filepath.Dir(path),
+		Extension: strings.TrimPrefix(filepath.Ext(path), "."),
+	}
+}
+
+// ecsAction 操作名转换成 ECS 习惯的小写连字符形式，如 CLOSE_WRITE -> close-write
+func ecsAction(op string) string {
+	return strings.NewReplacer("_", "-", "|", ",").Replace(strings.ToLower(op))
+}
+
+// ecsFileType 文件操作对应的 event.type (类别 file 允许的取值)
+func ecsFileType(op string) string {
+	switch {
+	case strings.Contains(op, "CREATE"):
+		return "creation"
+	case strings.Contains(op, "DELETE"):
+		return "deletion"
+	case strings.Contains(op, "CLOSE_WRITE"), strings.Contains(op, "MOVED"), strings.Contains(op, "RENAME"):
+		return "change"
+	}
+	return "access"
+}
+
+// ecsVerdictType 裁决对应的 event.type (类别 intrusion_detection 允许的取值)，没有裁决或审计模式时为空
+func ecsVerdictType(verdict string) string {
+	switch verdict {
+	case model.VerdictDeny:
+		return "denied"
+	case model.VerdictAllow, model.VerdictReadOnly:
+		return "allowed"
+	}
+	return ""
+}
+
+// ecsProcessInfo 把进程详情填进 process、user、container 和 usbsentry.process
+func ecsProcessInfo(doc *ecsDoc, p *model.ProcessInfo) {
+	proc := doc.Process
+	proc.Executable = p.Exe
+	proc.Args = p.Cmdline
+	proc.CommandLine = strings.Join(p.Cmdline, " ")
+	if !p.StartTime.IsZero() {
+		proc.Start = p.StartTime.UTC().Format(time.RFC3339Nano)
+	}
+	if p.ExeSHA256 != "" {
+		proc.Hash = &ecsHash{SHA256: p.ExeSHA256}
+	}
+	if len(p.Ancestors) > 0 {
+		a := p.Ancestors[0]
+		proc.Parent = &ecsProcessParent{PID: a.PID, Name: a.Name, Executable: a.Exe}
+	} else if p.PPID > 0 {
+		proc.Parent = &ecsProcessParent{PID: p.PPID}
+	}
+	proc.User = &ecsUser{ID: strconv.FormatUint(uint64(p.EUID), 10), Name: p.EUser}
+	proc.RealUser = &ecsUser{ID: strconv.FormatUint(uint64(p.UID), 10), Name: p.User}
+	if p.TTY != "" {
+		proc.TTY = &ecsTTY{Name: p.TTY}
+	}
+	// user.* 表示操作文件的账户，取 effective uid
+	doc.User = proc.User
+	if p.ContainerID != "" {
+		doc.Container = &ecsID{ID: p.ContainerID}
+	}
+	doc.USBSentry.Process = &ecsProcessExtra{
+		Ancestors:   p.Ancestors,
+		LoginUID:    p.LoginUID,
+		LoginUser:   p.LoginUser,
+		AuditSessID: p.AuditSessID,
+		Cgroup:      p.Cgroup,
+	}
+}
@@ -0,0 +1,89 @@
+package sink
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/Hara602/usbSentry/internal/model"
+)
+
+func TestECSFileType(t *testing.T) {
+	tests := []struct {
+		op, want string
+	}{
+		{"CREATE", "creation"},
+		{"DELETE", "deletion"},
+		{"CLOSE_WRITE", "change"},
+		{"RENAME", "change"},
+		{"MOVED_FROM", "change"},
+		{"OPEN_PERM", "access"},
+		{"OPEN_EXEC_PERM", "access"},
+		{"OPEN_PERM|CLOSE_WRITE", "change"},
+		{"CREATE|DELETE", "creation"},
+	}
+	for _, tt := range tests {
+		if got := ecsFileType(tt.op); got != tt.want {
+			t.Errorf("ecsFileType(%q) = %q, want %q", tt.op, got, tt.want)
+		}
+	}
+}
+
+func TestECSVerdictType(t *testing.T) {
+	tests := []struct {
+		verdict, want string
+	}{
+		{model.VerdictAllow, "allowed"},
+		{model.VerdictReadOnly, "allowed"},
+		{model.VerdictDeny, "denied"},
+		{model.VerdictWouldDeny, ""},
+		{"", ""},
+	}
+	for _, tt := range tests {
+		if got := ecsVerdictType(tt.verdict); got != tt.want {
+			t.Errorf("ecsVerdictType(%q) = %q, want %q", tt.verdict, got, tt.want)
+		}
+	}
+}
+
+// ecsAllowedTypes ECS 规定的各 event.category 可以搭配的 event.type (只列出用到的类别)
+var ecsAllowedTypes = map[string][]string{
+	"file":                {"access", "change", "creation", "deletion", "info"},
+	"host":                {"access", "change", "end", "info", "start"},
+	"intrusion_detection": {"allowed", "denied", "info"},
+	"session":             {"end", "info", "start"},
+}
+
+// 每个 type 至少属于文档中的一个 category，每个 category 至少有一个自己的 type
+func TestECSCategoryTypePairs(t *testing.T) {
+	dev := &model.DeviceContext{Device: model.Device{Vid: "0781", Pid: "5583", Serial: "AB1234"}}
+	events := map[string]model.Event{
+		"usb":                {Type: model.EventUSB, USB: &model.USBEvent{Action: "add"}},
+		"file create":        {Type: model.EventFile, File: &model.FileEvent{Operation: "CREATE", Device: dev}},
+		"file allowed":       {Type: model.EventFile, File: &model.FileEvent{Operation: "OPEN_PERM", Verdict: model.VerdictAllow}},
+		"file denied":        {Type: model.EventFile, File: &model.FileEvent{Operation: "OPEN_PERM", Verdict: model.VerdictDeny}},
+		"file would deny":    {Type: model.EventFile, File: &model.FileEvent{Operation: "OPEN_EXEC_PERM", Verdict: model.VerdictWouldDeny}},
+		"analysis":           {Type: model.EventAnalysis, Analysis: &model.AnalysisEvent{Analyzer: "badusb"}},
+		"analysis with file": {Type: model.EventAnalysis, Analysis: &model.AnalysisEvent{Analyzer: "filetype", FilePath: "/media/usb/a.pdf"}},
+		"session":            {Type: model.EventSession, Session: &model.SessionSummary{EndReason: "removed"}},
+	}
+	for name, ev := range events {
+		t.Run(name, func(t *testing.T) {
+			doc := toECS(ev)
+			categories, types := doc.Event.Category, doc.Event.Type
+			for _, c := range categories {
+				allowed, ok := ecsAllowedTypes[c]
+				if !ok {
+					t.Fatalf("unexpected category %q", c)
+				}
+				if !slices.ContainsFunc(types, func(typ string) bool { return slices.Contains(allowed, typ) }) {
+					t.Errorf("category %q has no allowed type in %v", c, types)
+				}
+			}
+			for _, typ := range types {
+				if !slices.ContainsFunc(categories, func(c string) bool { return slices.Contains(ecsAllowedTypes[c], typ) }) {
+					t.Errorf("type %q is not allowed for categories %v", typ, categories)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,191 @@
+package sink
+
+import (
+	"os"
+	"sync"
+	"time"
+
+	"github.com/Hara602/usbSentry/internal/config"
+	"github.com/Hara602/usbSentry/internal/metrics"
+	"github.com/Hara602/usbSentry/internal/model"
+	"github.com/Hara602/usbSentry/internal/sysutil"
+	"go.uber.org/zap"
+)
+
+// 重试间隔的上限
+const maxRetryBackoff = 30 * time.Second
+
+// Fanout 把事件分发给多个 sink
+// 每个 sink 有独立的缓冲队列和发送协程，一个 sink 卡住或失败不会影响其他 sink，也不会阻塞 Agent 主循环
+type Fanout struct {
+	host      string
+	workers   []*worker
+	recorders []Recorder
+	wg        sync.WaitGroup
+	abort     chan struct{} // 关闭超时后中断重试等待
+}
+
+type worker struct {
+	sink       Sink
+	queue      chan model.Event
+	maxRetries int
+	backoff    time.Duration
+	mu         sync.Mutex
+	dropped    uint64 // 队列满或重试耗尽丢弃的事件数
+}
+
+// NewFanout 按配置打开所有 sink，任何一个打开失败都会关闭已打开的并返回错误
+func NewFanout(cfgs []config.SinkConfig) (*Fanout, error) {
+	host, _ := os.Hostname()
+	f := &Fanout{host: host, abort: make(chan struct{})}
+	for _, cfg := range cfgs {
+		s, err := Open(cfg)
+		if err != nil {
+			for _, w := range f.workers {
+				w.sink.Close()
+			}
+			return nil, err
+		}
+		f.Attach(s, cfg)
+	}
+	return f, nil
+}
+
+// Attach 加入一个已经打开的 sink (如本地事件库)，cfg 中只使用缓冲和重试设置
+// 必须在第一次 Publish 之前调用
+func (f *Fanout) Attach(s Sink, cfg config.SinkConfig) {
+	w := &worker{sink: s, maxRetries: cfg.MaxRetries, backoff: cfg.RetryBackoff}
+	buffer := cfg.Buffer
+	if buffer == 0 {
+		buffer = defaultBuffer
+	}
+	if w.maxRetries == 0 {
+		w.maxRetries = defaultMaxRetries
+	}
+	if w.backoff == 0 {
+		w.backoff = defaultRetryBackoff
+	}
+	w.queue = make(chan model.Event, buffer)
+	f.workers = append(f.workers, w)
+	f.wg.Add(1)
+	go f.run(w)
+}
+
+// AttachRecorder 加入一个不能丢事件的目的地，Fanout 不负责关闭它
+// 必须在第一次 Publish 之前调用
+func (f *Fanout) AttachRecorder(r Recorder) {
+	f.recorders = append(f.recorders, r)
+}
+
+// Len 已配置的 sink 数量
+func (f *Fanout) Len() int { return len(f.workers) }
+
+// Pending 所有 sink 队列中等待发送的事件数
+func (f *Fanout) Pending() int {
+	n := 0
+	for _, w := range f.workers {
+		n += len(w.queue)
+	}
+	return n
+}
+
+// Publish 把事件放进每个 sink 的队列，队列满时丢弃 (不阻塞调用方)
+// Recorder 例外：它的队列满时 Publish 会等待
+func (f *Fanout) Publish(ev model.Event) {
+	if ev.Host == "" {
+		ev.Host = f.host
+	}
+	if ev.Time.IsZero() {
+		ev.Time = time.Now()
+	}
+	metrics.LastEvent.Set(float64(ev.Time.Unix()))
+	for _, w := range f.workers {
+		select {
+		case w.queue <- ev:
+		default:
+			w.drop(ev, "buffer full")
+		}
+	}
+	for _, r := range f.recorders {
+		r.Record(ev)
+	}
+}
+
+func (f *Fanout) run(w *worker) {
+	defer f.wg.Done()
+	for ev := range w.queue {
+		select {
+		case <-f.abort:
+			w.drop(ev, "shutting down")
+			continue
+		default:
+		}
+		f.deliver(w, ev)
+	}
+}
+
+// deliver 发送一个事件，失败按指数退避重试
+func (f *Fanout) deliver(w *worker, ev model.Event) {
+	backoff := w.backoff
+	for attempt := 0; ; attempt++ {
+		err := w.sink.Send(ev)
+		if err == nil {
+			return
+		}
+		if attempt >= w.maxRetries {
+			sysutil.Log.Warn("sink send failed, giving up",
+				zap.String("sink", w.sink.Name()),
+				zap.Int("attempts", attempt+1),
+				zap.Error(err))
+			w.drop(ev, "retries exhausted")
+			return
+		}
+		select {
+		case <-time.After(backoff):
+		case <-f.abort:
+			w.drop(ev, "shutting down")
+			return
+		}
+		backoff = min(backoff*2, maxRetryBackoff)
+	}
+}
+
+func (w *worker) drop(ev model.Event, why string) {
+	w.mu.Lock()
+	w.dropped++
+	n := w.dropped
+	w.mu.Unlock()
+	metrics.SinkDropped.WithLabelValues(w.sink.Name()).Inc()
+	// 持续丢弃时不刷屏：第 1 条和之后每 100 条记一次
+	if n == 1 || n%100 == 0 {
+		sysutil.Log.Warn("sink dropped event",
+			zap.String("sink", w.sink.Name()),
+			zap.String("why", why),
+			zap.String("type", ev.Type),
+			zap.Uint64("dropped_total", n))
+	}
+}
+
+// Close 停止接收事件，等待队列发送完毕 (最多 timeout)，然后关闭所有 sink
+// 调用 Close 之后不能再 Publish
+func (f *Fanout) Close(timeout time.Duration) {
+	for _, w := range f.workers {
+		close(w.queue)
+	}
+	done := make(chan struct{})
+	go func() {
+		f.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(timeout):
+		close(f.abort)
+		<-done
+	}
+	for _, w := range f.workers {
+		if err := w.sink.Close(); err != nil {
+			sysutil.Log.Warn("close sink failed", zap.String("sink", w.sink.Name()), zap.Error(err))
+		}
+	}
+}
@@ -0,0 +1,94 @@
+package sink
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/Hara602/usbSentry/internal/config"
+	"github.com/Hara602/usbSentry/internal/model"
+)
+
+// CEF/LEEF 头部中的厂商、产品和版本
+const (
+	vendorName     = "Hara602"
+	productName    = "usbSentry"
+	productVersion = "1.0"
+)
+
+// encoder 把事件编码成一条记录 (不含结尾换行)
+type encoder func(ev model.Event) ([]byte, error)
+
+func encoderFor(format string) (encoder, error) {
+	switch format {
+	case "", config.FormatJSON:
+		return func(ev model.Event) ([]byte, error) { return json.Marshal(ev) }, nil
+	case config.FormatECS:
+		return func(ev model.Event) ([]byte, error) { return json.Marshal(toECS(ev)) }, nil
+	case config.FormatCEF:
+		return func(ev model.Event) ([]byte, error) { return []byte(toCEF(ev)), nil }, nil
+	case config.FormatLEEF:
+		return func(ev model.Event) ([]byte, error) { return []byte(toLEEF(ev)), nil }, nil
+	}
+	return nil, fmt.Errorf("unknown sink format %q", format)
+}
+
+// contentType webhook 请求的 Content-Type
+func contentType(format string) string {
+	if format == config.FormatCEF || format == config.FormatLEEF {
+		return "text/plain; charset=utf-8"
+	}
+	return "application/json"
+}
+
+// severity 事件的严重程度 (0-10)，CEF/LEEF 共用，ECS 换算成 0-100
+func severity(ev model.Event) int {
+	switch {
+	case ev.Analysis != nil:
+		switch ev.Analysis.RiskLevel {
+		case "HIGH":
+			return 8
+		case "MEDIUM":
+			return 5
+		}
+		return 3
+	case ev.File != nil && ev.File.Verdict == model.VerdictDeny:
+		return 6
+	case ev.File != nil && ev.File.Verdict == model.VerdictWouldDeny:
+		return 4
+	case ev.USB != nil && ev.USB.DeviceType == model.DeviceTypeBadUSB:
+		return 8
+	}
+	return 1
+}
+
+// eventName 人类可读的事件标题 (CEF name / ECS message)
+func eventName(ev model.Event) string {
+	switch {
+	case ev.USB != nil && ev.USB.Action == "add":
+		return "USB storage connected"
+	case ev.USB != nil:
+		return "USB storage removed"
+	case ev.File != nil:
+		return "File " + ev.File.Operation
+	case ev.Analysis != nil:
+		return ev.Analysis.Message
+	case ev.Session != nil:
+		return "USB session ended"
+	}
+	return ev.Type
+}
+
+// signatureID CEF signature id / LEEF event id，如 file:CLOSE_WRITE、analysis:filetype
+func signatureID(ev model.Event) string {
+	switch {
+	case ev.USB != nil:
+		return "usb:" + ev.USB.Action
+	case ev.File != nil:
+		return "file:" + ev.File.Operation
+	case ev.Analysis != nil:
+		return "analysis:" + ev.Analysis.Analyzer
+	case ev.Session != nil:
+		return "session:" + ev.Session.EndReason
+	}
+	return ev.Type
+}
@@ -0,0 +1,55 @@
+package sink
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/Hara602/usbSentry/internal/analysis"
+	"github.com/Hara602/usbSentry/internal/model"
+)
+
+// fakeUSBDevice 在临时目录里模拟 sysfs 中的 USB 设备，每个接口一个 bInterfaceClass
+func fakeUSBDevice(t *testing.T, classes ...string) string {
+	t.Helper()
+	root := t.TempDir()
+	for i, class := range classes {
+		dir := filepath.Join(root, "1-1:1."+strconv.Itoa(i))
+		if err := os.Mkdir(dir, 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(dir, "bInterfaceClass"), []byte(class+"\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return root
+}
+
+func TestSeverityUSB(t *testing.T) {
+	tests := []struct {
+		name    string
+		classes []string
+		want    int
+	}{
+		{"storage and HID", []string{"08", "03"}, 8},
+		{"storage only", []string{"08"}, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, devType := analysis.CheckBadUSB(fakeUSBDevice(t, tt.classes...))
+			ev := model.Event{Type: model.EventUSB, USB: &model.USBEvent{Action: "add", DeviceType: devType}}
+			if got := severity(ev); got != tt.want {
+				t.Errorf("severity(%s) = %d, want %d", devType, got, tt.want)
+			}
+			// CEF:0|Vendor|Product|Version|SignatureID|Name|Severity|...
+			if got := strings.Split(toCEF(ev), "|")[6]; got != strconv.Itoa(tt.want) {
+				t.Errorf("CEF severity = %s, want %d", got, tt.want)
+			}
+			if got := toECS(ev).Event.Severity; got != tt.want*10 {
+				t.Errorf("ECS event.severity = %d, want %d", got, tt.want*10)
+			}
+		})
+	}
+}
@@ -0,0 +1,57 @@
+package sink
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/Hara602/usbSentry/internal/config"
+	"github.com/Hara602/usbSentry/internal/model"
+)
+
+// Sink 事件输出目的地
+// Send 返回错误时由 Fanout 负责重试，实现里不需要自己重试
+type Sink interface {
+	Name() string
+	Send(ev model.Event) error
+	Close() error
+}
+
+// Recorder 不能丢事件的目的地 (如本地事件库)
+// 不经过 Fanout 的缓冲队列，Publish 时同步调用 Record，由实现自己排队和写入，队列满时可以阻塞
+type Recorder interface {
+	Record(ev model.Event)
+}
+
+// 未配置时的缓冲与重试默认值
+const (
+	defaultBuffer       = 1024
+	defaultMaxRetries   = 3
+	defaultRetryBackoff = 500 * time.Millisecond
+	defaultTimeout      = 5 * time.Second
+)
+
+// Open 按配置创建 sink
+func Open(cfg config.SinkConfig) (Sink, error) {
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	enc, err := encoderFor(cfg.Format)
+	if err != nil {
+		return nil, err
+	}
+	switch cfg.Type {
+	case config.SinkJSONL:
+		return newFileSink(cfg.Path, enc)
+	case config.SinkStdout:
+		return newStdoutSink(enc), nil
+	case config.SinkWebhook:
+		timeout := cfg.Timeout
+		if timeout == 0 {
+			timeout = defaultTimeout
+		}
+		return newWebhookSink(cfg.URL, cfg.Headers, timeout, enc, contentType(cfg.Format)), nil
+	case config.SinkUnixgram:
+		return newUnixgramSink(cfg.Path, enc), nil
+	}
+	return nil, fmt.Errorf("unknown sink type %q", cfg.Type)
+}
@@ -0,0 +1,56 @@
+package sink
+
+import (
+	"net"
+	"sync"
+
+	"github.com/Hara602/usbSentry/internal/model"
+)
+
+// unixgramSink 每个事件一个数据报发到 unix datagram socket
+// 收集端重启后 socket 会重建，所以发送失败时断开，下次重新连接
+type unixgramSink struct {
+	path   string
+	encode encoder
+	mu     sync.Mutex
+	conn   net.Conn
+}
+
+func newUnixgramSink(path string, enc encoder) *unixgramSink {
+	return &unixgramSink{path: path, encode: enc}
+}
+
+func (s *unixgramSink) Name() string { return "unixgram:" + s.path }
+
+func (s *unixgramSink) Send(ev model.Event) error {
+	msg, err := s.encode(ev)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.conn == nil {
+		conn, err := net.Dial("unixgram", s.path)
+		if err != nil {
+			return err
+		}
+		s.conn = conn
+	}
+	if _, err := s.conn.Write(msg); err != nil {
+		s.conn.Close()
+		s.conn = nil
+		return err
+	}
+	return nil
+}
+
+func (s *unixgramSink) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.conn == nil {
+		return nil
+	}
+	err := s.conn.Close()
+	s.conn = nil
+	return err
+}
@@ -0,0 +1,65 @@
+package sink
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/Hara602/usbSentry/internal/model"
+)
+
+// webhookSink 每个事件一次 HTTP POST (JSON / ECS 为 application/json，CEF / LEEF 为 text/plain)
+type webhookSink struct {
+	url         string
+	headers     map[string]string
+	client      *http.Client
+	encode      encoder
+	contentType string
+}
+
+func newWebhookSink(url string, headers map[string]string, timeout time.Duration, enc encoder, contentType string) *webhookSink {
+	return &webhookSink{
+		url:         url,
+		headers:     headers,
+		client:      &http.Client{Timeout: timeout},
+		encode:      enc,
+		contentType: contentType,
+	}
+}
+
+func (s *webhookSink) Name() string { return "webhook:" + s.url }
+
+func (s *webhookSink) Send(ev model.Event) error {
+	body, err := s.encode(ev)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest(http.MethodPost, s.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", s.contentType)
+	req.Header.Set("User-Agent", "usbSentry")
+	for k, v := range s.headers {
+		req.Header.Set(k, v)
+	}
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	// 读完 body 才能复用连接
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+	resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("webhook returned %s", resp.Status)
+	}
+	return nil
+}
+
+func (s *webhookSink) Close() error {
+	s.client.CloseIdleConnections()
+	return nil
+}
@@ -0,0 +1,53 @@
+package sink
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sync"
+
+	"github.com/Hara602/usbSentry/internal/model"
+)
+
+// writerSink 每个事件一行 (JSON Lines，或 CEF/LEEF 文本)
+type writerSink struct {
+	name   string
+	encode encoder
+	mu     sync.Mutex
+	w      io.Writer
+	c      io.Closer // 为 nil 时 Close 不关闭底层 writer (stdout)
+}
+
+func newFileSink(path string, enc encoder) (*writerSink, error) {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0640)
+	if err != nil {
+		return nil, fmt.Errorf("open event file failed: %w", err)
+	}
+	return &writerSink{name: "jsonl:" + path, encode: enc, w: f, c: f}, nil
+}
+
+func newStdoutSink(enc encoder) *writerSink {
+	return &writerSink{name: "stdout", encode: enc, w: os.Stdout}
+}
+
+func (s *writerSink) Name() string { return s.name }
+
+func (s *writerSink) Send(ev model.Event) error {
+	line, err := s.encode(ev)
+	if err != nil {
+		return err
+	}
+	line = append(line, '\n')
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	// 一次 Write 写完整行，O_APPEND 下不会和其他写入者交错
+	_, err = s.w.Write(line)
+	return err
+}
+
+func (s *writerSink) Close() error {
+	if s.c == nil {
+		return nil
+	}
+	return s.c.Close()
+}
@@ -0,0 +1,43 @@
+// Package sqlitedb 黑白名单库和事件库共用的 SQLite 打开方式与表结构迁移
+package sqlitedb
+
+import (
+	"database/sql"
+	"fmt"
+
+	_ "modernc.org/sqlite"
+)
+
+// Open 打开 (必要时创建) SQLite 库
+// busy_timeout 写在 DSN 里，连接池中的每个连接都会设置；CLI、API 和 Agent 会同时访问同一个库
+func Open(path string) (*sql.DB, error) {
+	return sql.Open("sqlite", path+"?_pragma=busy_timeout(5000)")
+}
+
+// Migrate 按顺序执行尚未应用的表结构变更，版本号记录在 PRAGMA user_version 中
+func Migrate(db *sql.DB, migrations []string) error {
+	var version int
+	if err := db.QueryRow("PRAGMA user_version").Scan(&version); err != nil {
+		return err
+	}
+
+	for i := version; i < len(migrations); i++ {
+		tx, err := db.Begin()
+		if err != nil {
+			return err
+		}
+		if _, err := tx.Exec(migrations[i]); err != nil {
+			tx.Rollback()
+			return fmt.Errorf("migration v%d: %w", i+1, err)
+		}
+		// PRAGMA 不支持占位符
+		if _, err := tx.Exec(fmt.Sprintf("PRAGMA user_version = %d", i+1)); err != nil {
+			tx.Rollback()
+			return err
+		}
+		if err := tx.Commit(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
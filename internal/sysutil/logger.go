@@ -1,25 +1,124 @@
 package sysutil
 
 import (
+	"fmt"
 	"os"
+	"time"
 
 	"go.uber.org/zap"
 	"go.uber.org/zap/zapcore"
+	"gopkg.in/natefinch/lumberjack.v2"
 )
 
 var Log *zap.Logger
 var LogSugar *zap.SugaredLogger
 
-func InitLogger() {
-	config := zap.NewDevelopmentConfig()
-	config.EncoderConfig.EncodeTime = zapcore.ISO8601TimeEncoder        // 格式化时间输出
-	config.EncoderConfig.EncodeLevel = zapcore.CapitalColorLevelEncoder // 彩色级别
-	// 开发模式：输出到控制台，带颜色和行号
-	core := zapcore.NewCore(
-		zapcore.NewConsoleEncoder(config.EncoderConfig),
-		zapcore.AddSync(os.Stdout),
-		zap.DebugLevel,
-	)
-	Log = zap.New(core, zap.AddCaller())
+// LogOptions 日志配置
+// Format 为 console 时是开发模式 (彩色、人类可读)；json 为生产模式 (固定字段名，便于 ELK 等平台采集)
+type LogOptions struct {
+	Level  string // debug / info / warn / error
+	Format string // console / json
+	Output string // stdout / stderr / 文件路径
+
+	// 以下仅在 Output 为文件时生效，按大小切割，按时间和数量清理旧文件
+	MaxSizeMB  int  // 单个文件的最大大小 (MB)
+	MaxAgeDays int  // 旧文件保留天数，0 表示不按时间清理
+	MaxBackups int  // 旧文件保留个数，0 表示不按数量清理
+	Compress   bool // 旧文件 gzip 压缩
+}
+
+// JSON 日志的固定字段名，下游解析依赖这些名字，不要随意修改
+const (
+	LogKeyTime       = "ts"
+	LogKeyLevel      = "level"
+	LogKeyLogger     = "logger"
+	LogKeyCaller     = "caller"
+	LogKeyMessage    = "msg"
+	LogKeyStacktrace = "stacktrace"
+	LogKeyService    = "service"
+	LogKeyHost       = "host"
+)
+
+// InitLogger 初始化全局日志
+func InitLogger(opts LogOptions) error {
+	lvl, err := zapcore.ParseLevel(opts.Level)
+	if err != nil {
+		return fmt.Errorf("invalid log level %q: %w", opts.Level, err)
+	}
+
+	var sink zapcore.WriteSyncer
+	terminal := true
+	switch opts.Output {
+	case "", "stdout":
+		sink = zapcore.AddSync(os.Stdout)
+	case "stderr":
+		sink = zapcore.AddSync(os.Stderr)
+	default:
+		terminal = false
+		// 先试着打开一次，路径或权限有问题时启动即报错，而不是等到第一条日志
+		f, err := os.OpenFile(opts.Output, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0640)
+		if err != nil {
+			return fmt.Errorf("open log file failed: %w", err)
+		}
+		f.Close()
+		sink = zapcore.AddSync(&lumberjack.Logger{
+			Filename:   opts.Output,
+			MaxSize:    opts.MaxSizeMB,
+			MaxAge:     opts.MaxAgeDays,
+			MaxBackups: opts.MaxBackups,
+			Compress:   opts.Compress,
+		})
+	}
+
+	var core zapcore.Core
+	var zapOpts []zap.Option
+	switch opts.Format {
+	case "json":
+		// 生产模式：固定字段名、UTC 时间、Error 以上附带调用栈
+		core = zapcore.NewCore(zapcore.NewJSONEncoder(productionEncoderConfig()), sink, lvl)
+		host, _ := os.Hostname()
+		zapOpts = append(zapOpts,
+			zap.AddCaller(),
+			zap.AddStacktrace(zapcore.ErrorLevel),
+			zap.Fields(zap.String(LogKeyService, "usbSentry"), zap.String(LogKeyHost, host)),
+		)
+	case "console":
+		// 开发模式：输出到控制台，带颜色和行号
+		config := zap.NewDevelopmentEncoderConfig()
+		config.EncodeTime = zapcore.ISO8601TimeEncoder // 格式化时间输出
+		if terminal {
+			config.EncodeLevel = zapcore.CapitalColorLevelEncoder // 彩色级别，写文件时不加颜色控制符
+		}
+		core = zapcore.NewCore(zapcore.NewConsoleEncoder(config), sink, lvl)
+		zapOpts = append(zapOpts, zap.AddCaller())
+	default:
+		return fmt.Errorf("invalid log format %q", opts.Format)
+	}
+
+	Log = zap.New(core, zapOpts...)
 	LogSugar = Log.Sugar()
+	// 第三方库走标准库 log 的输出也统一进来
+	zap.RedirectStdLog(Log)
+	return nil
+}
+
+func productionEncoderConfig() zapcore.EncoderConfig {
+	return zapcore.EncoderConfig{
+		TimeKey:        LogKeyTime,
+		LevelKey:       LogKeyLevel,
+		NameKey:        LogKeyLogger,
+		CallerKey:      LogKeyCaller,
+		FunctionKey:    zapcore.OmitKey,
+		MessageKey:     LogKeyMessage,
+		StacktraceKey:  LogKeyStacktrace,
+		LineEnding:     zapcore.DefaultLineEnding,
+		EncodeLevel:    zapcore.LowercaseLevelEncoder,
+		EncodeTime:     utcRFC3339Nano,
+		EncodeDuration: zapcore.StringDurationEncoder,
+		EncodeCaller:   zapcore.ShortCallerEncoder,
+	}
+}
+
+func utcRFC3339Nano(t time.Time, enc zapcore.PrimitiveArrayEncoder) {
+	enc.AppendString(t.UTC().Format(time.RFC3339Nano))
 }
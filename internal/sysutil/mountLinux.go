@@ -4,15 +4,18 @@ package sysutil
 
 import (
 	"bufio"
+	"fmt"
 	"os"
 	"strings"
 	"time"
+
+	"golang.org/x/sys/unix"
 )
 
 // WaitForMount 轮询 /proc/mounts 等待设备挂载
-func WaitForMount(devPath string) string {
-	// 尝试 3 秒，因为 Udev event 触发时，文件系统可能还没挂载好
-	for i := 0; i < 30; i++ {
+// Udev event 触发时，文件系统可能还没挂载好，最多等待 timeout
+func WaitForMount(devPath string, timeout, interval time.Duration) string {
+	for deadline := time.Now().Add(timeout); time.Now().Before(deadline); {
 		f, _ := os.Open("/proc/mounts")
 		scanner := bufio.NewScanner(f)
 		for scanner.Scan() {
@@ -23,7 +26,28 @@ func WaitForMount(devPath string) string {
 			}
 		}
 		f.Close()
-		time.Sleep(100 * time.Millisecond)
+		time.Sleep(interval)
 	}
 	return ""
 }
+
+// RemountReadOnly 把已挂载的文件系统重新挂载为只读
+func RemountReadOnly(mountPoint string) error {
+	if err := unix.Mount("", mountPoint, "", unix.MS_REMOUNT|unix.MS_RDONLY, ""); err != nil {
+		return fmt.Errorf("remount %s ro failed: %w", mountPoint, err)
+	}
+	return nil
+}
+
+// SetBlockDeviceReadOnly 通过 BLKROSET 把块设备设为只读 (等同于 blockdev --setro)
+func SetBlockDeviceReadOnly(devPath string) error {
+	fd, err := unix.Open(devPath, unix.O_RDONLY|unix.O_CLOEXEC, 0)
+	if err != nil {
+		return fmt.Errorf("open %s failed: %w", devPath, err)
+	}
+	defer unix.Close(fd)
+	if err := unix.IoctlSetPointerInt(fd, unix.BLKROSET, 1); err != nil {
+		return fmt.Errorf("BLKROSET %s failed: %w", devPath, err)
+	}
+	return nil
+}
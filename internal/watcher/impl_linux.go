@@ -2,7 +2,6 @@ package watcher
 
 import (
 	"bufio"
-	"log"
 	"os"
 	"path/filepath"
 	"strings"
@@ -10,19 +9,26 @@ import (
 
 	"github.com/Hara602/usbSentry/internal/analysis"
 	"github.com/Hara602/usbSentry/internal/blackwhitelist"
+	"github.com/Hara602/usbSentry/internal/metrics"
 	"github.com/Hara602/usbSentry/internal/model"
+	"github.com/Hara602/usbSentry/internal/registry"
 	"github.com/Hara602/usbSentry/internal/sysutil"
 	"github.com/pilebones/go-udev/netlink"
 	"go.uber.org/zap"
 )
 
 type linuxWatcher struct {
+	cfg    Config
 	events chan model.USBEvent
 	stop   chan struct{}
 }
 
-func newWatcher() DeviceWatcher {
+func newWatcher(cfg Config) DeviceWatcher {
+	if cfg.Registry == nil {
+		cfg.Registry = registry.New()
+	}
 	return &linuxWatcher{
+		cfg:    cfg,
 		events: make(chan model.USBEvent, 10),
 		stop:   make(chan struct{}),
 	}
@@ -96,30 +102,44 @@ func (w *linuxWatcher) handleAdd(uevent netlink.UEvent) {
 		zap.String("product", product))
 
 	// BadUSB 分析
-	isBad, devType := analysis.CheckBadUSB(usbRoot)
+	isBad, devType := w.checkBadUSB(usbRoot)
+	readOnly := blackwhitelist.IsBlocked(model.Device{Vid: vid, Pid: pid, Serial: serial, Product: product}).ReadOnly
 
-	mountPoint := sysutil.WaitForMount(devName)
+	mountPoint := sysutil.WaitForMount(devName, w.cfg.MountTimeout, w.cfg.MountPoll)
 	if mountPoint == "" {
 		sysutil.LogSugar.Warn("Device detected but mount point not found (timeout)", zap.String("dev", devName))
 		return
 	}
 
-	w.events <- model.USBEvent{
+	w.add(model.USBEvent{
 		Action:     "add",
 		DevicePath: devName,
+		SysPath:    usbRoot,
 		MountPoint: mountPoint,
 		IdVendor:   vid,
 		IdProduct:  pid,
+		Product:    product,
 		Serial:     serial,
 		DeviceType: devType,
+		ReadOnly:   readOnly,
+		SessionID:  newSessionID(),
 		TimeStamp:  time.Now(),
-	}
+	})
 
 	if isBad {
 		sysutil.LogSugar.Warn("🚨 POTENTIAL BADUSB DETECTED", zap.String("serial", serial))
 	}
 }
 
+// checkBadUSB 未启用 BadUSB 分析器时，只区分是否为存储设备
+func (w *linuxWatcher) checkBadUSB(usbRoot string) (bool, string) {
+	isBad, devType := analysis.CheckBadUSB(usbRoot)
+	if !w.cfg.BadUSB && isBad {
+		return false, model.DeviceTypeUDisk
+	}
+	return isBad, devType
+}
+
 // findUSBRoot 递归向上查找包含 idVendor 的目录（即 USB Device 根目录）
 func findUSBRoot(path string) string {
 	dir := path
@@ -155,6 +175,7 @@ func (w *linuxWatcher) scanExistingUSB() {
 	}
 	defer f.Close()
 
+	blocked := map[string]bool{}
 	scanner := bufio.NewScanner(f)
 	for scanner.Scan() {
 		line := scanner.Text()
@@ -192,22 +213,39 @@ func (w *linuxWatcher) scanExistingUSB() {
 			pid := readFile(filepath.Join(usbRoot, "idProduct"))
 			serial := readFile(filepath.Join(usbRoot, "serial"))
 			product := readFile(filepath.Join(usbRoot, "product"))
-			isBad, devType := analysis.CheckBadUSB(usbRoot)
+			isBad, devType := w.checkBadUSB(usbRoot)
+			dev := model.Device{Vid: vid, Pid: pid, Serial: serial, Product: product, Manufacturer: readFile(filepath.Join(usbRoot, "manufacturer"))}
 			sysutil.Log.Info("🔍 Found existing USB device during scan",
 				zap.String("mount", mountPoint),
 				zap.String("dev", devPath))
+			// 同一设备的多个分区只裁决、阻断一次
+			busID := filepath.Base(usbRoot)
+			if blocked[busID] {
+				continue
+			}
+			decision := blackwhitelist.IsBlocked(dev)
+			readOnly := decision.ReadOnly
+			w.recordDevice(dev, decision, false)
+			// Agent 启动前就已接入的设备同样要执行裁决 (如 default-deny 模式下未放行的设备)
+			if decision.Blocked && w.block(decision, busID) {
+				blocked[busID] = true
+				continue
+			}
 			// 发送事件
-			w.events <- model.USBEvent{
+			w.add(model.USBEvent{
 				Action:     "add",
 				DevicePath: devPath,
+				SysPath:    usbRoot,
 				MountPoint: mountPoint,
 				IdVendor:   vid,
 				IdProduct:  pid,
 				Product:    product,
 				Serial:     serial,
 				DeviceType: devType,
+				ReadOnly:   readOnly,
+				SessionID:  newSessionID(),
 				TimeStamp:  time.Now(),
-			}
+			})
 			if isBad {
 				sysutil.Log.Warn("🚨 POTENTIAL BADUSB DETECTED (Existing)", zap.String("serial", serial))
 			}
@@ -217,6 +255,14 @@ func (w *linuxWatcher) scanExistingUSB() {
 }
 
 func (w *linuxWatcher) handleUdevEvent(uevent netlink.UEvent) {
+	// 整个 USB 设备拔出：补发它名下还没收到 remove 的分区
+	if uevent.Env["SUBSYSTEM"] == "usb" && uevent.Env["DEVTYPE"] == "usb_device" && uevent.Action == "remove" {
+		for _, ev := range w.cfg.Registry.RemoveDevice(filepath.Join("/sys", uevent.Env["DEVPATH"])) {
+			w.sendRemove(ev)
+		}
+		return
+	}
+
 	// 获取设备的信息，裁定是否阻断设备的连接
 	if uevent.Env["SUBSYSTEM"] == "usb" && uevent.Env["DEVTYPE"] == "usb_device" {
 		if uevent.Action == "add" {
@@ -228,22 +274,20 @@ func (w *linuxWatcher) handleUdevEvent(uevent netlink.UEvent) {
 			vid := readFile(filepath.Join(usbRoot, "idVendor"))
 			pid := readFile(filepath.Join(usbRoot, "idProduct"))
 			serial := readFile(filepath.Join(usbRoot, "serial"))
+			product := readFile(filepath.Join(usbRoot, "product"))
+			manufacturer := readFile(filepath.Join(usbRoot, "manufacturer"))
 			sysutil.Log.Info("checking device information:",
 				zap.String("vid", vid),
 				zap.String("pid", pid),
 				zap.String("serial", serial),
-				zap.String("busID", busID))
-			shouldBlock, reason := blackwhitelist.IsBlocked(vid, pid, serial)
-			if shouldBlock {
-				sysutil.Log.Warn("🚫 [拦截] 发现黑名单/高危设备! 原因:", zap.String("reason", reason))
-
-				// 执行物理阻断
-				if err := blackwhitelist.BlockDevice(busID); err != nil {
-					log.Printf("❌ 阻断失败: %v", err)
-				} else {
-					log.Println("✅ 设备已成功阻断 (Authorized=0)")
-				}
-
+				zap.String("product", product),
+				zap.String("manufacturer", manufacturer),
+				zap.String("bus_id", busID))
+			dev := model.Device{Vid: vid, Pid: pid, Serial: serial, Product: product, Manufacturer: manufacturer}
+			decision := blackwhitelist.IsBlocked(dev)
+			w.recordDevice(dev, decision, true)
+			if decision.Blocked {
+				w.block(decision, busID)
 				// 阻断后直接 return，不要启动后面的文件监控了
 				return
 			}
@@ -256,7 +300,62 @@ func (w *linuxWatcher) handleUdevEvent(uevent netlink.UEvent) {
 		if uevent.Action == "add" {
 			go w.handleAdd(uevent)
 		} else if uevent.Action == "remove" {
-			w.events <- model.USBEvent{Action: "remove", DevicePath: uevent.Env["DEVNAME"], TimeStamp: time.Now()}
+			devName := uevent.Env["DEVNAME"]
+			if !strings.HasPrefix(devName, "/dev") {
+				devName = "/dev/" + devName // 与 add 事件保持一致
+			}
+			// 没有挂载过 (没有发过 add) 的分区不需要 remove
+			if ev, ok := w.cfg.Registry.Remove(devName); ok {
+				w.sendRemove(ev)
+			} else {
+				sysutil.Log.Debug("remove for untracked partition", zap.String("dev", devName))
+			}
 		}
 	}
 }
+
+// block 按裁决执行物理阻断 (Authorized=0)
+// 返回 false 表示审计模式下只记录不阻断，设备照常放行
+func (w *linuxWatcher) block(decision blackwhitelist.Decision, busID string) bool {
+	fields := []zap.Field{zap.String("reason", decision.Reason), zap.String("mode", decision.Mode)}
+	if decision.Rule != nil {
+		fields = append(fields,
+			zap.Int64("rule_id", decision.Rule.ID),
+			zap.String("rule_list", decision.Rule.ListType),
+			zap.String("rule_reason", decision.Rule.Reason))
+	}
+	sysutil.Log.Warn("🚫 [拦截] 发现黑名单/高危设备! 原因:", fields...)
+
+	if w.cfg.Audit {
+		sysutil.Log.Warn("🔍 审计模式: 仅记录，不阻断设备", zap.String("bus_id", busID))
+		return false
+	}
+
+	if err := blackwhitelist.BlockDevice(busID); err != nil {
+		sysutil.Log.Error("❌ 阻断失败", zap.String("bus_id", busID), zap.Error(err))
+	} else {
+		sysutil.Log.Info("✅ 设备已成功阻断 (Authorized=0)", zap.String("bus_id", busID))
+		metrics.DevicesBlocked.WithLabelValues("policy").Inc()
+	}
+	return true
+}
+
+// add 登记已挂载的分区并发出 add 事件
+func (w *linuxWatcher) add(ev model.USBEvent) {
+	w.cfg.Registry.Add(ev)
+	w.events <- ev
+}
+
+// sendRemove 用登记时的设备信息发出 remove 事件
+func (w *linuxWatcher) sendRemove(ev model.USBEvent) {
+	ev.Action = "remove"
+	ev.TimeStamp = time.Now()
+	w.events <- ev
+}
+
+// recordDevice 写入历史设备清单，失败只记日志
+func (w *linuxWatcher) recordDevice(dev model.Device, decision blackwhitelist.Decision, inserted bool) {
+	if err := blackwhitelist.RecordDevice(dev, decision.Verdict(w.cfg.Audit), decision.Reason, inserted); err != nil {
+		sysutil.Log.Warn("record device inventory failed", zap.String("serial", dev.Serial), zap.Error(err))
+	}
+}
@@ -2,10 +2,10 @@
 
 package watcher
 
-import "usbSentry/internal/model"
+import "github.com/Hara602/usbSentry/internal/model"
 
 type winWatcher struct{}
 
-func newWatcher() DeviceWatcher                             { return &winWatcher{} }
+func newWatcher(cfg Config) DeviceWatcher                   { return &winWatcher{} }
 func (w *winWatcher) Start() (<-chan model.USBEvent, error) { return nil, nil }
 func (w *winWatcher) Stop()                                 {}
@@ -1,6 +1,13 @@
 package watcher
 
-import "github.com/Hara602/usbSentry/internal/model"
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"time"
+
+	"github.com/Hara602/usbSentry/internal/model"
+	"github.com/Hara602/usbSentry/internal/registry"
+)
 
 // DeviceWatcher 定义接口
 type DeviceWatcher interface {
@@ -8,6 +15,22 @@ type DeviceWatcher interface {
 	Stop()
 }
 
-func New() DeviceWatcher {
-	return newWatcher()
+// Config 设备监听的可选行为
+type Config struct {
+	BadUSB       bool               // 是否做 BadUSB 检测
+	Audit        bool               // 审计模式：命中黑名单只告警，不写 authorized=0
+	MountTimeout time.Duration      // 等待分区挂载的最长时间
+	MountPoll    time.Duration      // 轮询 /proc/mounts 的间隔
+	Registry     *registry.Registry // 已连接设备表，remove 事件从这里取回完整的设备信息；nil 时内部新建
+}
+
+func New(cfg Config) DeviceWatcher {
+	return newWatcher(cfg)
+}
+
+// newSessionID 为一次插入生成唯一 ID，同一会话的所有事件都带上它
+func newSessionID() string {
+	var b [8]byte
+	rand.Read(b[:])
+	return hex.EncodeToString(b[:])
 }